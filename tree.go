@@ -8,6 +8,18 @@
 // - Customizable node sorting and formatting
 // - Built-in tree validation (circular references, ID uniqueness)
 //
+// Errors: failures that callers may want to branch on wrap one of the
+// exported sentinel errors (ErrEmptyData, ErrInvalidID, ErrDuplicateID,
+// ErrInvalidParent, ErrSelfParent, ErrCircularReference, ErrNodeNotFound),
+// so they can be detected with errors.Is. Errors about a specific node are a
+// *NodeError carrying its ID, available through errors.As.
+//
+// Empty results: methods returning a slice never return nil. When there is
+// nothing to return (a leaf, a missing node, a negative depth), they return a
+// non-nil empty slice, so callers can rely on len() and on reflect.DeepEqual
+// against an empty literal. Only methods that also return an error return a
+// nil slice alongside a non-nil error.
+//
 // Basic usage:
 //
 //	type Category struct {
@@ -49,12 +61,74 @@
 package tree
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"iter"
+	"maps"
 	"reflect"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unique"
+)
+
+// Sentinel errors wrapped by the errors of this package; use errors.Is to detect them.
+var (
+	// ErrEmptyData is returned by the load functions when there is no data.
+	ErrEmptyData = errors.New("empty data")
+	// ErrInvalidID reports a node ID that is not positive or doesn't match its key.
+	ErrInvalidID = errors.New("invalid node ID")
+	// ErrDuplicateID reports a node ID that appears more than once.
+	ErrDuplicateID = errors.New("duplicate node ID")
+	// ErrInvalidParent reports a parent ID that is negative or refers to a missing node.
+	ErrInvalidParent = errors.New("invalid parent ID")
+	// ErrSelfParent reports a node that names itself as its parent.
+	ErrSelfParent = errors.New("node is its own parent")
+	// ErrCircularReference reports a cycle in the parent chain, or a move that would create one.
+	ErrCircularReference = errors.New("circular reference")
+	// ErrNodeNotFound reports an argument that refers to a node that doesn't exist.
+	ErrNodeNotFound = errors.New("node not found")
 )
 
+// NodeError reports an error caused by a specific node, e.g. a duplicate or
+// a node with a missing parent. Err is one of the sentinel errors, so both
+// errors.Is and errors.As work:
+//
+//	var nodeErr *tree.NodeError
+//	if errors.As(err, &nodeErr) && errors.Is(err, tree.ErrInvalidParent) {
+//	    log.Printf("node %d has no parent", nodeErr.ID)
+//	}
+type NodeError struct {
+	ID  int   // ID of the offending node
+	Err error // The reason, one of the sentinel errors
+
+	msg string // Detailed message; defaults to "node <ID>: <Err>"
+}
+
+// nodeErrorf returns a NodeError for the node with a detailed message.
+func nodeErrorf(id int, err error, format string, args ...any) *NodeError {
+	return &NodeError{ID: id, Err: err, msg: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the detailed message of the error.
+func (e *NodeError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("node %d: %v", e.ID, e.Err)
+}
+
+// Unwrap returns the sentinel error, for errors.Is.
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
 // Node represents a single node in the tree structure.
 // It is generic over type T which represents the node's data.
 // The zero value is not usable; use tree.New to create a new tree.
@@ -70,8 +144,37 @@ type Node[T any] struct {
 // The zero value is not usable; use tree.New to create a new tree.
 type Tree[T any] struct {
 	sync.RWMutex
-	nodes    map[int]*Node[T]   // Map of all nodes indexed by ID
-	children map[int][]*Node[T] // Pre-sorted children lists indexed by parent ID
+	nodes        map[int]*Node[T]       // Map of all nodes indexed by ID
+	children     map[int][]*Node[T]     // Pre-sorted children lists indexed by parent ID
+	meta         map[int]map[string]any // Per-node metadata indexed by node ID, then key
+	idFunc       func(T) int            // ID function from the last Load, used by AddNode
+	parentIDFunc func(T) int            // Parent ID function from the last Load, used by AddNode
+	sortFunc     func(a, b T) bool      // Sibling sort function from the last Load, nil to sort by ID
+	intern       []string               // Interned fields from the last Load (see WithStringInterning)
+	unsorted     map[int]bool           // Parent IDs whose children are not sorted yet (see WithLazySort)
+	manual       map[int]bool           // Parent IDs whose children were ordered by MoveBefore or MoveAfter
+	stable       bool                   // Whether equal siblings keep their input order (see WithInputOrderTiebreak)
+	report       LoadReport             // Repairs made by the last Load (see WithRepair)
+	stats        LoadStats              // Phase timings of the last Load (see LastLoadStats)
+
+	displayMu    sync.Mutex                        // Guards display and displayOrder, which readers fill under the read lock
+	display      map[displayKey][]FormattedNode[T] // Cached FormatTreeDisplay results, cleared by every mutation
+	displayOrder []displayKey                      // Keys of display from oldest to newest, for evicting the oldest
+}
+
+// LoadReport lists the repairs made by the last Load with WithRepair.
+// Both lists are empty after a load without repairs.
+type LoadReport struct {
+	Rerooted   []int // IDs of nodes whose parent was missing or the node itself, moved to the root level
+	Duplicates []int // IDs that appeared more than once; only the first occurrence was kept
+}
+
+// LoadStats holds the phase timings of the last Load, for performance monitoring.
+type LoadStats struct {
+	Nodes    int           // Number of nodes in the loaded tree
+	Validate time.Duration // ID validation before building plus the structure check after it
+	Build    time.Duration // Creating the nodes and children lists, including repairs
+	Sort     time.Duration // Sorting the children lists; near zero with WithLazySort
 }
 
 // New creates and returns a new Tree instance.
@@ -82,7 +185,59 @@ func New[T any]() *Tree[T] {
 	return &Tree[T]{
 		nodes:    make(map[int]*Node[T]),
 		children: make(map[int][]*Node[T]),
+		meta:     make(map[int]map[string]any),
+	}
+}
+
+// Clone returns a deep copy of the tree, taken under the read lock, as a
+// consistent point-in-time view: later changes to either tree don't affect
+// the other. The nodes, children lists and metadata maps are copied, while
+// the node data itself is copied by value. The ID, parent ID and sort
+// functions and other options of the last Load carry over, so AddNode and
+// lazy sorting keep working on the clone.
+// This lets read-heavy callers snapshot once and query the clone without
+// contending with writers.
+//
+// Example:
+//
+//	snapshot := tree.Clone()
+//	rows := snapshot.FormatTreeDisplay(1, tree.DefaultFormatOption())
+func (t *Tree[T]) Clone() *Tree[T] {
+	t.RLock()
+	defer t.RUnlock()
+
+	clone := &Tree[T]{
+		nodes:        make(map[int]*Node[T], len(t.nodes)),
+		children:     make(map[int][]*Node[T], len(t.children)),
+		meta:         make(map[int]map[string]any, len(t.meta)),
+		idFunc:       t.idFunc,
+		parentIDFunc: t.parentIDFunc,
+		sortFunc:     t.sortFunc,
+		intern:       slices.Clone(t.intern),
+		unsorted:     maps.Clone(t.unsorted),
+		manual:       maps.Clone(t.manual),
+		stable:       t.stable,
+		report: LoadReport{
+			Rerooted:   slices.Clone(t.report.Rerooted),
+			Duplicates: slices.Clone(t.report.Duplicates),
+		},
+		stats: t.stats,
+	}
+	for id, node := range t.nodes {
+		copied := *node
+		clone.nodes[id] = &copied
 	}
+	for parentID, children := range t.children {
+		list := make([]*Node[T], len(children))
+		for i, child := range children {
+			list[i] = clone.nodes[child.ID]
+		}
+		clone.children[parentID] = list
+	}
+	for id, values := range t.meta {
+		clone.meta[id] = maps.Clone(values)
+	}
+	return clone
 }
 
 // validateIDs checks if the node IDs are valid.
@@ -90,10 +245,10 @@ func New[T any]() *Tree[T] {
 //   - The input slice is empty
 //   - Any ID is non-positive
 //   - Any parent ID is negative
-//   - There are duplicate IDs
-func validateIDs[T any](items []T, idFunc func(T) int, parentIDFunc func(T) int) error {
+//   - There are duplicate IDs, unless allowDuplicates is set
+func validateIDs[T any](items []T, idFunc func(T) int, parentIDFunc func(T) int, allowDuplicates bool) error {
 	if len(items) == 0 {
-		return fmt.Errorf("empty data")
+		return ErrEmptyData
 	}
 
 	// Check for valid IDs and parent IDs
@@ -102,17 +257,17 @@ func validateIDs[T any](items []T, idFunc func(T) int, parentIDFunc func(T) int)
 		// Validate ID
 		id := idFunc(item)
 		if id <= 0 {
-			return fmt.Errorf("item %d: ID must be positive", i)
+			return nodeErrorf(id, ErrInvalidID, "item %d: ID must be positive", i)
 		}
-		if idSet[id] {
-			return fmt.Errorf("duplicate node ID: %d", id)
+		if idSet[id] && !allowDuplicates {
+			return nodeErrorf(id, ErrDuplicateID, "duplicate node ID: %d", id)
 		}
 		idSet[id] = true
 
 		// Validate ParentID
 		parentID := parentIDFunc(item)
 		if parentID < 0 {
-			return fmt.Errorf("item %d: parent ID cannot be negative", i)
+			return nodeErrorf(id, ErrInvalidParent, "item %d: parent ID cannot be negative", i)
 		}
 	}
 
@@ -135,7 +290,14 @@ type LoadOption[T any] func(*loadOptions[T])
 type loadOptions[T any] struct {
 	idFunc       func(T) int       // Function to extract node ID
 	parentIDFunc func(T) int       // Function to extract parent ID
-	sortFunc     func(a, b T) bool // Function to sort siblings
+	sortFunc     func(a, b T) bool // Function to sort siblings, nil to sort by node ID
+	lazySort     bool              // Defer sorting children until they're first read
+	stableSort   bool              // Keep input order for siblings that compare equal
+	internFields []string          // Names of string fields whose values are interned
+	afterLoad    func(t *Tree[T])  // Hook invoked after a successful load
+	maxNodes     int               // Maximum number of items accepted (0 for unlimited)
+	repair       bool              // Repair dangling parents and duplicate IDs instead of failing
+	err          error             // Invalid option detected while applying it, reported by Load
 }
 
 // WithIDFunc returns an option to set the ID extraction function.
@@ -155,7 +317,8 @@ func WithParentIDFunc[T any](f func(T) int) LoadOption[T] {
 }
 
 // WithSort returns an option to set the sibling sorting function.
-// If not provided, nodes will be sorted by ID in ascending order.
+// If not provided, nodes will be sorted by their ID, as returned by the ID
+// function, in ascending order.
 //
 // Example:
 //
@@ -170,220 +333,1170 @@ func WithSort[T any](f func(a, b T) bool) LoadOption[T] {
 	}
 }
 
-// Load initializes the tree with data using the provided options.
-// It validates the data structure and builds the internal node maps.
-//
-// The provided options must include at least:
-//   - WithIDFunc to specify how to get node IDs
-//   - WithParentIDFunc to specify how to get parent IDs
+// SortByIntField returns an option to sort siblings in ascending order of the
+// named integer field of T (any signed or unsigned integer kind), without
+// writing a comparison closure. The field is looked up once via reflection;
+// if T is not a struct or the field is missing or not an integer, Load returns
+// an error.
 //
 // Example:
 //
-//	err := tree.Load(categories,
-//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
-//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
-//	)
-//
-// Returns an error if:
-//   - Required options are missing
-//   - Data validation fails
-//   - Tree structure is invalid (e.g., circular references)
-func (t *Tree[T]) Load(items []T, opts ...LoadOption[T]) error {
-	// Initialize default options
-	options := &loadOptions[T]{
-		// Default sorts by ID in ascending order
-		sortFunc: func(a, b T) bool {
-			return reflect.ValueOf(a).FieldByName("ID").Int() <
-				reflect.ValueOf(b).FieldByName("ID").Int()
-		},
-	}
+//	tree.Load(items, WithIDFunc(...), WithParentIDFunc(...), SortByIntField[Category]("Sort"))
+func SortByIntField[T any](name string) LoadOption[T] {
+	return sortByField[T](name, "an integer", func(kind reflect.Kind) bool {
+		return reflect.Int <= kind && kind <= reflect.Uint64
+	}, func(a, b reflect.Value) bool {
+		if a.CanInt() {
+			return a.Int() < b.Int()
+		}
+		return a.Uint() < b.Uint()
+	})
+}
 
-	// Apply options
-	for _, opt := range opts {
-		opt(options)
-	}
+// SortByStringField returns an option to sort siblings in ascending byte order
+// of the named string field of T. Like SortByIntField, Load returns an error
+// if T is not a struct or the field is missing or not a string.
+//
+// Example:
+//
+//	tree.Load(items, WithIDFunc(...), WithParentIDFunc(...), SortByStringField[Category]("Name"))
+func SortByStringField[T any](name string) LoadOption[T] {
+	return sortByField[T](name, "a string", func(kind reflect.Kind) bool {
+		return kind == reflect.String
+	}, func(a, b reflect.Value) bool {
+		return a.String() < b.String()
+	})
+}
 
-	// Validate required options
-	if options.idFunc == nil {
-		return fmt.Errorf("id function is required")
+// sortByField builds a sort option comparing the named field of T with less.
+// The field is validated against accepts once, and an invalid field is
+// recorded as an option error instead of panicking during the sort.
+func sortByField[T any](name, kindName string, accepts func(reflect.Kind) bool, less func(a, b reflect.Value) bool) LoadOption[T] {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return func(o *loadOptions[T]) {
+			o.err = fmt.Errorf("sort field %q: %v is not a struct type", name, typ)
+		}
 	}
-	if options.parentIDFunc == nil {
-		return fmt.Errorf("parent id function is required")
+	field, ok := typ.FieldByName(name)
+	if !ok || !accepts(field.Type.Kind()) {
+		return func(o *loadOptions[T]) {
+			o.err = fmt.Errorf("sort field %q is not %s field of %v", name, kindName, typ)
+		}
 	}
 
-	// First validate IDs
-	if err := validateIDs(items, options.idFunc, options.parentIDFunc); err != nil {
-		return fmt.Errorf("invalid data: %v", err)
-	}
+	return WithSort(func(a, b T) bool {
+		return less(reflect.ValueOf(a).FieldByIndex(field.Index), reflect.ValueOf(b).FieldByIndex(field.Index))
+	})
+}
 
-	t.Lock()
-	defer t.Unlock()
+// WithNaturalSort returns an option to sort siblings by the string returned by
+// key, using natural (human) ordering: runs of digits compare by their numeric
+// value, so "2" sorts before "10" and "file9" before "file10".
+// Other characters compare byte by byte, as with the < operator.
+//
+// Example:
+//
+//	tree.Load(chapters,
+//	    WithNaturalSort[Chapter](func(c Chapter) string { return c.Title }),
+//	)
+func WithNaturalSort[T any](key func(T) string) LoadOption[T] {
+	return WithSort(func(a, b T) bool {
+		return naturalLess(key(a), key(b))
+	})
+}
 
-	// Clear existing data
-	t.nodes = make(map[int]*Node[T])
-	t.children = make(map[int][]*Node[T])
+// WithSortFunc2 returns an option to sort pinned siblings before all others.
+// primary reports whether a node has an explicit order and what it is; nodes
+// with one are pinned and sort by that order, the others by secondary. Whether a node is
+// pinned is decided per node, so pinned and unpinned nodes can be mixed under
+// the same parent. Pinned siblings with the same order fall back to secondary.
+//
+// Example:
+//
+//	// Items with an Order float to the top, the rest sort by name
+//	tree.Load(menu,
+//	    WithSortFunc2(
+//	        func(m MenuItem) (bool, int) { return m.Order != nil, deref(m.Order) },
+//	        func(a, b MenuItem) bool { return a.Name < b.Name },
+//	    ),
+//	)
+func WithSortFunc2[T any](primary func(T) (hasOrder bool, order int), secondary func(a, b T) bool) LoadOption[T] {
+	return WithSort(func(a, b T) bool {
+		aPinned, aOrder := primary(a)
+		bPinned, bOrder := primary(b)
+		if aPinned != bPinned {
+			return aPinned
+		}
+		if aPinned && aOrder != bOrder {
+			return aOrder < bOrder
+		}
+		return secondary(a, b)
+	})
+}
+
+// naturalLess reports whether a sorts before b in natural order.
+// Digit runs are compared by numeric value without converting them to
+// integers, so arbitrarily long numbers are supported. Strings that only
+// differ in leading zeros fall back to plain byte order to stay deterministic.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			// Extract both digit runs and skip leading zeros
+			startA, startB := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(a[startA:i], "0")
+			numB := strings.TrimLeft(b[startB:j], "0")
 
-	// Create nodes
-	for _, item := range items {
-		id := options.idFunc(item)
-		parentID := options.parentIDFunc(item)
+			// A longer number without leading zeros is larger
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			if numA != numB {
+				return numA < numB
+			}
+			continue
+		}
 
-		node := &Node[T]{
-			ID:       id,
-			ParentID: parentID,
-			Data:     item,
+		if a[i] != b[j] {
+			return a[i] < b[j]
 		}
-		t.nodes[id] = node
-		t.children[parentID] = append(t.children[parentID], node)
+		i++
+		j++
 	}
 
-	// Sort children for each parent
-	for parentID, children := range t.children {
-		sort.Slice(children, func(i, j int) bool {
-			return options.sortFunc(children[i].Data, children[j].Data)
-		})
-		t.children[parentID] = children
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
 	}
+	return a < b
+}
 
-	// Validate tree integrity
-	return t.validateTree()
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
 
-// validateTree ensures the integrity of the tree structure.
-// Returns an error if:
-//   - Any node references a non-existent parent
-//   - The tree contains circular references
-func (t *Tree[T]) validateTree() error {
-	// First check parent ID validity
-	for _, node := range t.nodes {
-		if node.ParentID != 0 {
-			if _, exists := t.nodes[node.ParentID]; !exists {
-				return fmt.Errorf("invalid parent ID %d for node %d", node.ParentID, node.ID)
-			}
-		}
+// WithLazySort returns an option to defer sorting of children lists.
+// Instead of sorting every parent's children during Load, each children list
+// is sorted the first time it is read, and the sorted result is kept.
+// GetChildren sorts only the requested list; traversals spanning many parents
+// sort all pending lists at once.
+//
+// This speeds up Load for write-heavy workloads that rarely read the tree.
+// On-demand sorting happens under the write lock, so concurrent first reads
+// are race-free.
+func WithLazySort[T any]() LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.lazySort = true
 	}
+}
 
-	// Then check for circular references
-	visited := make(map[int]bool)
-	for id := range t.nodes {
-		if err := t.checkCircularRef(id, visited); err != nil {
-			return err
-		}
-		// Clear visited map for reuse
-		for k := range visited {
-			delete(visited, k)
-		}
+// WithInputOrderTiebreak returns an option to keep siblings that compare equal
+// under the sort function in the order they appear in the input.
+// Children lists are built in input order and sorted with a stable sort,
+// which makes the result deterministic when many siblings share a sort key.
+// With LoadMap the input order is the random map iteration order.
+//
+// Example:
+//
+//	tree.Load(items,
+//	    WithSort[Category](func(a, b Category) bool { return a.Group < b.Group }),
+//	    WithInputOrderTiebreak[Category](),
+//	)
+func WithInputOrderTiebreak[T any]() LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.stableSort = true
 	}
-	return nil
 }
 
-// checkCircularRef recursively checks for circular references.
-// Returns an error if a circular reference is detected.
-func (t *Tree[T]) checkCircularRef(id int, visited map[int]bool) error {
-	if visited[id] {
-		return fmt.Errorf("circular reference detected at node %d", id)
+// WithStringInterning returns an option to intern the named string fields of
+// the node data during Load. Identical values then share a single backing
+// string, which saves memory when a field holds few distinct values across
+// many nodes (e.g. a category or status name).
+// T must be a struct and every named field must be an exported string field,
+// otherwise Load returns an error.
+//
+// Example:
+//
+//	tree.Load(products,
+//	    WithIDFunc[Product](func(p Product) int { return p.ID }),
+//	    WithParentIDFunc[Product](func(p Product) int { return p.ParentID }),
+//	    WithStringInterning[Product]("Category", "Status"),
+//	)
+func WithStringInterning[T any](fields ...string) LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.internFields = append(o.internFields, fields...)
 	}
-	visited[id] = true
-	node := t.nodes[id]
-	if node.ParentID != 0 {
-		return t.checkCircularRef(node.ParentID, visited)
+}
+
+// WithAfterLoad returns an option to run fn every time data is loaded
+// successfully, e.g. to rebuild a secondary index or log statistics.
+//
+// The hook runs after Load (or LoadMap) has released the write lock, so it
+// may freely call any method of the tree, including the thread-safe readers.
+// It runs in the loading goroutine before Load returns; a concurrent writer
+// could still modify the tree before the hook reads it.
+// The hook is not invoked if loading fails.
+//
+// Example:
+//
+//	tree.Load(items,
+//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
+//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
+//	    WithAfterLoad(func(t *tree.Tree[Category]) {
+//	        index.Rebuild(t.GetDescendants(rootID, 0))
+//	    }),
+//	)
+func WithAfterLoad[T any](fn func(t *Tree[T])) LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.afterLoad = fn
 	}
-	return nil
 }
 
-// FindNode returns a node by its ID.
-// Returns (nil, false) if the node doesn't exist.
+// WithMaxNodes returns an option to cap the number of nodes a tree can hold.
+// Load returns an error when the input has more than n items; the check runs
+// before any node is built, so oversized input is rejected without allocating.
+// A value of 0 or less means unlimited, which is the default.
 //
 // Example:
 //
-//	if node, exists := tree.FindNode(123); exists {
-//	    fmt.Printf("Found node: %v\n", node.Data)
-//	}
-func (t *Tree[T]) FindNode(id int) (*Node[T], bool) {
-	t.RLock()
-	defer t.RUnlock()
-	node, exists := t.nodes[id]
-	return node, exists
+//	err := tree.Load(rows,
+//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
+//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
+//	    WithMaxNodes[Category](10000),
+//	)
+func WithMaxNodes[T any](n int) LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.maxNodes = n
+	}
 }
 
-// GetParent returns the parent node of the specified node.
-// Returns (nil, false) if either the node or its parent doesn't exist.
+// WithRepair returns an option to make Load lenient about two common data
+// errors and repair them instead of failing:
+//   - A node whose parent doesn't exist, or which is its own parent,
+//     is moved to the root level (ParentID 0)
+//   - A duplicate ID keeps the first occurrence and drops the later ones
+//
+// The repairs are listed in LastLoadReport, for logging and alerting.
+// Other errors, such as non-positive IDs or cycles spanning several nodes,
+// still make Load fail.
 //
 // Example:
 //
-//	if parent, exists := tree.GetParent(childID); exists {
-//	    fmt.Printf("Parent: %v\n", parent.Data)
+//	err := tree.Load(rows,
+//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
+//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
+//	    WithRepair[Category](),
+//	)
+//	if report := tree.LastLoadReport(); len(report.Rerooted) > 0 {
+//	    log.Printf("re-rooted orphans: %v", report.Rerooted)
 //	}
-func (t *Tree[T]) GetParent(id int) (*Node[T], bool) {
-	t.RLock()
-	defer t.RUnlock()
-	node, exists := t.nodes[id]
-	if !exists {
-		return nil, false
+func WithRepair[T any]() LoadOption[T] {
+	return func(o *loadOptions[T]) {
+		o.repair = true
 	}
-	parent, exists := t.nodes[node.ParentID]
-	return parent, exists
 }
 
-// GetParentID returns the parent ID of the specified node.
-// Returns (0, false) if the node doesn't exist.
-func (t *Tree[T]) GetParentID(id int) (int, bool) {
-	t.RLock()
-	defer t.RUnlock()
-	node, exists := t.nodes[id]
-	if !exists {
-		return 0, false
+// Load initializes the tree with data using the provided options.
+// It validates the data structure and builds the internal node maps.
+//
+// The provided options must include at least:
+//   - WithIDFunc to specify how to get node IDs
+//   - WithParentIDFunc to specify how to get parent IDs
+//
+// Example:
+//
+//	err := tree.Load(categories,
+//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
+//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
+//	)
+//
+// Returns an error if:
+//   - Required options are missing
+//   - The input exceeds the limit set by WithMaxNodes
+//   - Data validation fails
+//   - Tree structure is invalid (e.g., circular references)
+func (t *Tree[T]) Load(items []T, opts ...LoadOption[T]) error {
+	options, err := newLoadOptions(opts)
+	if err != nil {
+		return err
 	}
-	return node.ParentID, true
+	if err := options.checkMaxNodes(len(items)); err != nil {
+		return err
+	}
+
+	// First validate IDs
+	start := time.Now()
+	if err := validateIDs(items, options.idFunc, options.parentIDFunc, options.repair); err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+
+	return t.load(nodesOf(slices.Values(items), options), options, time.Since(start))
 }
 
-// GetChildren returns all immediate children of the specified node.
-// The children are returned in the order determined by the sort function.
-// Returns nil if the node has no children.
+// LoadMap initializes the tree with data from a map keyed by node ID.
+// It accepts the same options as Load and replaces any existing data.
 //
-// Example:
+// Since map keys are unique, no duplicate check is needed, but each key must
+// match the ID returned by the ID function. Parent references and circular
+// references are validated as in Load.
 //
-//	children := tree.GetChildren(parentID)
-//	for _, child := range children {
-//	    fmt.Printf("Child: %v\n", child.Data)
-//	}
+// Map iteration order is random, so siblings that compare equal under a
+// custom sort function may end up in a different order on every load.
+// Provide a sort function that fully orders siblings for stable output.
 //
-// Example return structure for node ID 1:
+// Example:
 //
-//	[
-//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},
-//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}}
-//	]
-func (t *Tree[T]) GetChildren(id int) []*Node[T] {
-	t.RLock()
-	defer t.RUnlock()
-	return t.children[id]
+//	err := tree.LoadMap(cache,
+//	    WithIDFunc[Category](func(c Category) int { return c.ID }),
+//	    WithParentIDFunc[Category](func(c Category) int { return c.ParentID }),
+//	)
+func (t *Tree[T]) LoadMap(items map[int]T, opts ...LoadOption[T]) error {
+	options, err := newLoadOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := options.checkMaxNodes(len(items)); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := validateMapIDs(items, options.idFunc, options.parentIDFunc); err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+
+	return t.load(nodesOf(maps.Values(items), options), options, time.Since(start))
 }
 
-// GetChildrenIDs returns all children IDs of the specified node.
-// Returns nil if the node has no children.
+// LoadFromNested initializes the tree from a nested node structure, such as
+// the output of ToTree, replacing any existing data. It closes the round trip
+// from ToTree (or ToJSONIndent, see LoadFromJSON) back to a tree.
+//
+// The IDs are taken from the ID and ParentID fields of the nodes, so
+// WithIDFunc and WithParentIDFunc are not required; the other options apply
+// as in Load, e.g. WithSort to sort siblings. The given nodes are not
+// modified or retained, the tree stores copies of them.
+// Note that AddNode needs the ID functions, so pass them if nodes will be
+// added later.
+//
+// The top-level node always becomes a root with ParentID 0, so a subtree
+// from ToTree on a non-root node loads back as a tree of its own.
+//
+// Returns an error if:
+//   - The root is nil
+//   - An ID is not positive, a parent ID is negative, or an ID is duplicated
+//   - A child's ParentID doesn't match the ID of the node it is nested in
+//   - A node is nested inside itself
+//   - Tree structure is invalid, as in Load
 //
 // Example:
 //
-//	if ids := tree.GetChildrenIDs(parentID); len(ids) > 0 {
-//	    fmt.Printf("Child IDs: %v\n", ids)
-//	}
-func (t *Tree[T]) GetChildrenIDs(id int) []int {
-	children := t.GetChildren(id)
-	if len(children) == 0 {
-		return nil
+//	snapshot := src.ToTree(rootID)
+//	err := dst.LoadFromNested(snapshot,
+//	    WithSort(func(a, b Category) bool { return a.Name < b.Name }),
+//	)
+func (t *Tree[T]) LoadFromNested(root *Node[T], opts ...LoadOption[T]) error {
+	options, err := applyLoadOptions(opts)
+	if err != nil {
+		return err
 	}
 
-	ids := make([]int, len(children))
-	for i, child := range children {
-		ids[i] = child.ID
+	start := time.Now()
+	nodes, err := flattenNested(root, options.repair)
+	if err != nil {
+		return fmt.Errorf("invalid data: %w", err)
 	}
-	return ids
+	if err := options.checkMaxNodes(len(nodes)); err != nil {
+		return err
+	}
+
+	return t.load(slices.Values(nodes), options, time.Since(start))
 }
 
-// GetAncestors returns all ancestor nodes of the specified node.
-// If includeSelf is true, the node itself will be included as the first element.
-// Returns nodes ordered from the node itself (if included) up to the root.
+// LoadFromJSON works like LoadFromNested but decodes the nested structure
+// from JSON in the format written by ToJSONIndent, or by json.Marshal of a
+// ToTree result.
+//
+// Example:
+//
+//	data, _ := src.ToJSONIndent(rootID, "", "  ")
+//	err := dst.LoadFromJSON(data)
+func (t *Tree[T]) LoadFromJSON(data []byte, opts ...LoadOption[T]) error {
+	var root *Node[T]
+	if err := json.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return t.LoadFromNested(root, opts...)
+}
+
+// flattenNested returns copies of the nodes in a nested structure in
+// depth-first order, without their children, and validates their IDs.
+// Duplicate IDs are only allowed in repair mode.
+func flattenNested[T any](root *Node[T], allowDuplicates bool) ([]*Node[T], error) {
+	if root == nil {
+		return nil, ErrEmptyData
+	}
+
+	nodes := make([]*Node[T], 0)
+	seen := make(map[*Node[T]]bool)
+	ids := make(map[int]bool)
+	stack := []*Node[T]{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Also guards against pointer cycles, which would never end
+		if seen[node] {
+			return nil, nodeErrorf(node.ID, ErrCircularReference, "node %d is nested inside itself", node.ID)
+		}
+		seen[node] = true
+
+		if node.ID <= 0 {
+			return nil, nodeErrorf(node.ID, ErrInvalidID, "node %d: ID must be positive", node.ID)
+		}
+		if node.ParentID < 0 {
+			return nil, nodeErrorf(node.ID, ErrInvalidParent, "node %d: parent ID cannot be negative", node.ID)
+		}
+		if ids[node.ID] && !allowDuplicates {
+			return nil, nodeErrorf(node.ID, ErrDuplicateID, "duplicate node ID: %d", node.ID)
+		}
+		ids[node.ID] = true
+		parentID := node.ParentID
+		if node == root {
+			// The top-level node may come from a subtree, its parent isn't loaded
+			parentID = 0
+		}
+		nodes = append(nodes, &Node[T]{ID: node.ID, ParentID: parentID, Data: node.Data})
+
+		// Push in reverse so the first child is visited first
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			child := node.Children[i]
+			if child == nil {
+				return nil, fmt.Errorf("node %d has a nil child", node.ID)
+			}
+			if child.ParentID != node.ID {
+				return nil, nodeErrorf(child.ID, ErrInvalidParent,
+					"node %d: parent ID %d doesn't match its parent node %d", child.ID, child.ParentID, node.ID)
+			}
+			stack = append(stack, child)
+		}
+	}
+	return nodes, nil
+}
+
+// newLoadOptions applies the given options on top of the defaults
+// and checks that the required options are present.
+func newLoadOptions[T any](opts []LoadOption[T]) (*loadOptions[T], error) {
+	options, err := applyLoadOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate required options
+	if options.idFunc == nil {
+		return nil, fmt.Errorf("id function is required")
+	}
+	if options.parentIDFunc == nil {
+		return nil, fmt.Errorf("parent id function is required")
+	}
+	return options, nil
+}
+
+// applyLoadOptions applies the given options on top of the defaults and
+// validates them, without requiring the ID functions.
+func applyLoadOptions[T any](opts []LoadOption[T]) (*loadOptions[T], error) {
+	// The default nil sortFunc sorts by node ID, see sortChildren
+	options := &loadOptions[T]{}
+
+	// Apply options
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	// Validate interned fields up front, T is known statically
+	if len(options.internFields) > 0 {
+		typ := reflect.TypeFor[T]()
+		if typ.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("string interning requires a struct type, got %v", typ)
+		}
+		for _, name := range options.internFields {
+			field, ok := typ.FieldByName(name)
+			if !ok || !field.IsExported() || field.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("intern field %q is not an exported string field", name)
+			}
+		}
+	}
+	return options, nil
+}
+
+// checkMaxNodes returns an error if n items exceed the configured node limit.
+func (o *loadOptions[T]) checkMaxNodes(n int) error {
+	if o.maxNodes > 0 && n > o.maxNodes {
+		return fmt.Errorf("too many nodes: %d exceeds the limit of %d", n, o.maxNodes)
+	}
+	return nil
+}
+
+// validateMapIDs checks if the node IDs of a map keyed by ID are valid.
+// Returns an error if:
+//   - The input map is empty
+//   - Any key is non-positive
+//   - Any key differs from the ID of its item
+//   - Any parent ID is negative
+func validateMapIDs[T any](items map[int]T, idFunc func(T) int, parentIDFunc func(T) int) error {
+	if len(items) == 0 {
+		return ErrEmptyData
+	}
+
+	for key, item := range items {
+		if key <= 0 {
+			return nodeErrorf(key, ErrInvalidID, "key %d: ID must be positive", key)
+		}
+		if id := idFunc(item); id != key {
+			return nodeErrorf(key, ErrInvalidID, "key %d: item has ID %d", key, id)
+		}
+		if parentIDFunc(item) < 0 {
+			return nodeErrorf(key, ErrInvalidParent, "key %d: parent ID cannot be negative", key)
+		}
+	}
+
+	return nil
+}
+
+// load builds the tree under the write lock, then runs the after-load hook
+// once the lock is released. validated is the time spent on ID validation.
+func (t *Tree[T]) load(items iter.Seq[*Node[T]], options *loadOptions[T], validated time.Duration) error {
+	t.Lock()
+	t.invalidateDisplay()
+	err := t.build(items, options)
+	t.stats.Validate += validated
+	t.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if options.afterLoad != nil {
+		options.afterLoad(t)
+	}
+	return nil
+}
+
+// nodesOf returns the items wrapped in new nodes, with the IDs extracted by
+// the ID functions of the options.
+func nodesOf[T any](items iter.Seq[T], options *loadOptions[T]) iter.Seq[*Node[T]] {
+	return func(yield func(*Node[T]) bool) {
+		for item := range items {
+			node := &Node[T]{
+				ID:       options.idFunc(item),
+				ParentID: options.parentIDFunc(item),
+				Data:     item,
+			}
+			if !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// build replaces the tree content with the given nodes, sorts the children
+// lists and validates the resulting structure. The load report is only
+// replaced if the structure is valid.
+// The nodes must be new values without children that already passed ID
+// validation.
+// The caller must hold the write lock.
+func (t *Tree[T]) build(items iter.Seq[*Node[T]], options *loadOptions[T]) error {
+	// Clear existing data
+	t.nodes = make(map[int]*Node[T])
+	t.children = make(map[int][]*Node[T])
+	t.meta = make(map[int]map[string]any)
+	report := LoadReport{Rerooted: make([]int, 0), Duplicates: make([]int, 0)}
+	t.stats = LoadStats{}
+	start := time.Now()
+
+	// Index nodes
+	for node := range items {
+		// Only repair mode lets duplicates through validation
+		if _, exists := t.nodes[node.ID]; exists {
+			if !slices.Contains(report.Duplicates, node.ID) {
+				report.Duplicates = append(report.Duplicates, node.ID)
+			}
+			continue
+		}
+
+		if len(options.internFields) > 0 {
+			internStrings(&node.Data, options.internFields)
+		}
+		t.nodes[node.ID] = node
+		t.children[node.ParentID] = append(t.children[node.ParentID], node)
+	}
+
+	if options.repair {
+		report.Rerooted = t.rerootOrphans()
+	}
+	t.stats.Nodes = len(t.nodes)
+	t.stats.Build = time.Since(start)
+	start = time.Now()
+
+	// Sort children for each parent, or defer it until they're read
+	t.idFunc = options.idFunc
+	t.parentIDFunc = options.parentIDFunc
+	t.intern = options.internFields
+	t.sortFunc = options.sortFunc
+	t.stable = options.stableSort
+	t.unsorted = make(map[int]bool)
+	t.manual = make(map[int]bool)
+	for parentID := range t.children {
+		if options.lazySort {
+			t.unsorted[parentID] = true
+		} else {
+			t.sortChildren(parentID)
+		}
+	}
+	t.stats.Sort = time.Since(start)
+	start = time.Now()
+
+	// Validate tree integrity
+	err := t.validateTree()
+	t.stats.Validate = time.Since(start)
+	if err != nil {
+		return err
+	}
+	t.report = report
+	return nil
+}
+
+// rerootOrphans moves every node whose parent doesn't exist, or which is its
+// own parent, to the root level and returns their IDs in ascending order.
+// The caller must hold the write lock.
+func (t *Tree[T]) rerootOrphans() []int {
+	rerooted := make([]int, 0)
+	for id, node := range t.nodes {
+		if node.ParentID == 0 {
+			continue
+		}
+		if _, exists := t.nodes[node.ParentID]; exists && node.ParentID != id {
+			continue
+		}
+		rerooted = append(rerooted, id)
+	}
+
+	// Move in ID order so the root list is built deterministically
+	slices.Sort(rerooted)
+	for _, id := range rerooted {
+		node := t.nodes[id]
+		t.detachChild(node)
+		node.ParentID = 0
+		t.children[0] = append(t.children[0], node)
+	}
+	return rerooted
+}
+
+// LastLoadReport returns the repairs made by the last successful Load or
+// LoadMap with WithRepair. A failed load keeps the report of the previous
+// one. The report is empty if nothing was repaired or the option was not
+// used.
+func (t *Tree[T]) LastLoadReport() LoadReport {
+	t.RLock()
+	defer t.RUnlock()
+	return LoadReport{
+		Rerooted:   append(make([]int, 0, len(t.report.Rerooted)), t.report.Rerooted...),
+		Duplicates: append(make([]int, 0, len(t.report.Duplicates)), t.report.Duplicates...),
+	}
+}
+
+// LastLoadStats returns the phase timings and node count of the last Load or
+// LoadMap that got past ID validation, e.g. to graph load performance.
+// The stats are zero if the tree was never loaded.
+//
+// Example:
+//
+//	stats := tree.LastLoadStats()
+//	log.Printf("loaded %d nodes: validate=%v build=%v sort=%v",
+//	    stats.Nodes, stats.Validate, stats.Build, stats.Sort)
+func (t *Tree[T]) LastLoadStats() LoadStats {
+	t.RLock()
+	defer t.RUnlock()
+	return t.stats
+}
+
+// sortChildren sorts the children of the specified parent with the stored sort
+// function, or by node ID in ascending order if there is none. The IDs come
+// from the ID function, so the default works for any T.
+// The caller must hold the write lock.
+func (t *Tree[T]) sortChildren(parentID int) {
+	children := t.children[parentID]
+	less := func(i, j int) bool {
+		return children[i].ID < children[j].ID
+	}
+	if t.sortFunc != nil {
+		less = func(i, j int) bool {
+			return t.sortFunc(children[i].Data, children[j].Data)
+		}
+	}
+	if t.stable {
+		sort.SliceStable(children, less)
+	} else {
+		sort.Slice(children, less)
+	}
+	delete(t.unsorted, parentID)
+	delete(t.manual, parentID)
+}
+
+// sortPending sorts all children lists deferred by WithLazySort.
+// The caller must hold the write lock.
+func (t *Tree[T]) sortPending() {
+	for parentID := range t.unsorted {
+		t.sortChildren(parentID)
+	}
+}
+
+// rLockSorted acquires the read lock once no children list is pending a lazy sort.
+// Pending lists are sorted under the write lock first.
+func (t *Tree[T]) rLockSorted() {
+	for {
+		t.RLock()
+		if len(t.unsorted) == 0 {
+			return
+		}
+		t.RUnlock()
+
+		t.Lock()
+		t.sortPending()
+		t.Unlock()
+	}
+}
+
+// rLockSortedChildren acquires the read lock once the children of the specified
+// parent are sorted. Unlike rLockSorted, other pending lists are left untouched.
+func (t *Tree[T]) rLockSortedChildren(parentID int) {
+	for {
+		t.RLock()
+		if !t.unsorted[parentID] {
+			return
+		}
+		t.RUnlock()
+
+		t.Lock()
+		t.sortChildren(parentID)
+		t.Unlock()
+	}
+}
+
+// internStrings replaces the values of the named string fields of data with
+// their canonical interned copies. The fields must have been validated.
+func internStrings[T any](data *T, fields []string) {
+	v := reflect.ValueOf(data).Elem()
+	for _, name := range fields {
+		f := v.FieldByName(name)
+		f.SetString(unique.Make(f.String()).Value())
+	}
+}
+
+// validateTree ensures the integrity of the tree structure.
+// Returns an error if:
+//   - Any node references a non-existent parent
+//   - The tree contains circular references
+func (t *Tree[T]) validateTree() error {
+	// First check parent ID validity.
+	// A self-parented node is reported on its own, it's a common data-entry
+	// mistake that the cycle check would only report as a generic cycle.
+	for _, node := range t.nodes {
+		if node.ParentID == node.ID {
+			return &NodeError{ID: node.ID, Err: ErrSelfParent}
+		}
+		if node.ParentID != 0 {
+			if _, exists := t.nodes[node.ParentID]; !exists {
+				return nodeErrorf(node.ID, ErrInvalidParent, "invalid parent ID %d for node %d", node.ParentID, node.ID)
+			}
+		}
+	}
+
+	// Then check for circular references.
+	// Nodes whose chain is known to reach a root are remembered,
+	// so every node is walked at most once.
+	reachesRoot := make(map[int]bool, len(t.nodes))
+	visited := make(map[int]bool)
+	for id := range t.nodes {
+		if err := t.checkCircularRef(id, visited, reachesRoot); err != nil {
+			return err
+		}
+		// Clear visited map for reuse
+		for k := range visited {
+			delete(visited, k)
+		}
+	}
+	return nil
+}
+
+// checkCircularRef walks up the parent chain of the given node and
+// returns an error if a circular reference is detected.
+// Every node of a chain that reaches a root is added to reachesRoot.
+func (t *Tree[T]) checkCircularRef(id int, visited, reachesRoot map[int]bool) error {
+	currentID := id
+	for currentID != 0 && !reachesRoot[currentID] {
+		if visited[currentID] {
+			return nodeErrorf(currentID, ErrCircularReference, "circular reference detected at node %d", currentID)
+		}
+		visited[currentID] = true
+		currentID = t.nodes[currentID].ParentID
+	}
+
+	for k := range visited {
+		reachesRoot[k] = true
+	}
+	return nil
+}
+
+// FindNode returns a node by its ID.
+// Returns (nil, false) if the node doesn't exist.
+//
+// Example:
+//
+//	if node, exists := tree.FindNode(123); exists {
+//	    fmt.Printf("Found node: %v\n", node.Data)
+//	}
+func (t *Tree[T]) FindNode(id int) (*Node[T], bool) {
+	t.RLock()
+	defer t.RUnlock()
+	node, exists := t.nodes[id]
+	return node, exists
+}
+
+// MissingIDs returns the IDs from ids that don't exist in the tree,
+// preserving their input order. All IDs are checked under a single read lock.
+// Returns an empty slice if every ID exists.
+//
+// Example:
+//
+//	if missing := tree.MissingIDs(product.CategoryIDs); len(missing) > 0 {
+//	    return fmt.Errorf("unknown categories: %v", missing)
+//	}
+func (t *Tree[T]) MissingIDs(ids []int) []int {
+	t.RLock()
+	defer t.RUnlock()
+
+	missing := make([]int, 0)
+	for _, id := range ids {
+		if _, exists := t.nodes[id]; !exists {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// SetMeta attaches a metadata value to the specified node under the given key.
+// Metadata lives beside the node data, which makes it suitable for transient
+// state such as UI expansion or selection that doesn't belong in T.
+// All metadata is cleared by Load. Does nothing if the node doesn't exist.
+//
+// Example:
+//
+//	tree.SetMeta(nodeID, "expanded", true)
+func (t *Tree[T]) SetMeta(id int, key string, value any) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, exists := t.nodes[id]; !exists {
+		return
+	}
+	if t.meta[id] == nil {
+		t.meta[id] = make(map[string]any)
+	}
+	t.meta[id][key] = value
+}
+
+// GetMeta returns the metadata value stored for the specified node under the given key.
+// Returns (nil, false) if the node or the key doesn't exist.
+//
+// Example:
+//
+//	if expanded, ok := tree.GetMeta(nodeID, "expanded"); ok && expanded.(bool) {
+//	    renderChildren(nodeID)
+//	}
+func (t *Tree[T]) GetMeta(id int, key string) (any, bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	value, exists := t.meta[id][key]
+	return value, exists
+}
+
+// GetParent returns the parent node of the specified node.
+// Returns (nil, false) if either the node or its parent doesn't exist.
+//
+// Example:
+//
+//	if parent, exists := tree.GetParent(childID); exists {
+//	    fmt.Printf("Parent: %v\n", parent.Data)
+//	}
+func (t *Tree[T]) GetParent(id int) (*Node[T], bool) {
+	t.RLock()
+	defer t.RUnlock()
+	node, exists := t.nodes[id]
+	if !exists {
+		return nil, false
+	}
+	parent, exists := t.nodes[node.ParentID]
+	return parent, exists
+}
+
+// GetParentID returns the parent ID of the specified node.
+// Returns (0, false) if the node doesn't exist.
+func (t *Tree[T]) GetParentID(id int) (int, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	node, exists := t.nodes[id]
+	if !exists {
+		return 0, false
+	}
+	return node.ParentID, true
+}
+
+// GetRoots returns the top-level nodes of the tree, i.e. all nodes with
+// ParentID 0, in the order determined by the sort function. A tree loaded
+// from data with several top-level items is a forest with several roots.
+// It is the same as GetChildren(0).
+// Returns an empty slice for an empty tree.
+//
+// Example:
+//
+//	for _, root := range tree.GetRoots() {
+//	    fmt.Printf("Top-level category: %v\n", root.Data)
+//	}
+func (t *Tree[T]) GetRoots() []*Node[T] {
+	return t.GetChildren(0)
+}
+
+// GetRootIDs returns the IDs of the top-level nodes in sorted order.
+// It is the same as GetChildrenIDs(0).
+func (t *Tree[T]) GetRootIDs() []int {
+	return t.GetChildrenIDs(0)
+}
+
+// GetChildren returns all immediate children of the specified node.
+// The children are returned in the order determined by the sort function.
+// Returns an empty slice if the node has no children.
+//
+// Example:
+//
+//	children := tree.GetChildren(parentID)
+//	for _, child := range children {
+//	    fmt.Printf("Child: %v\n", child.Data)
+//	}
+//
+// Example return structure for node ID 1:
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},
+//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}}
+//	]
+func (t *Tree[T]) GetChildren(id int) []*Node[T] {
+	t.rLockSortedChildren(id)
+	defer t.RUnlock()
+
+	children, exists := t.children[id]
+	if !exists {
+		return make([]*Node[T], 0)
+	}
+	return children
+}
+
+// GetChildrenChecked works like GetChildren but also reports whether the
+// specified node exists, to tell an unknown ID from a known leaf without a
+// separate FindNode call. ID 0 addresses the root level and always exists.
+//
+// Example:
+//
+//	children, exists := tree.GetChildrenChecked(folderID)
+//	if !exists {
+//	    return fmt.Errorf("folder %d not found", folderID)
+//	}
+func (t *Tree[T]) GetChildrenChecked(id int) ([]*Node[T], bool) {
+	t.rLockSortedChildren(id)
+	defer t.RUnlock()
+
+	if _, exists := t.nodes[id]; !exists && id != 0 {
+		return make([]*Node[T], 0), false
+	}
+	children, exists := t.children[id]
+	if !exists {
+		return make([]*Node[T], 0), true
+	}
+	return children, true
+}
+
+// ExpandableNode pairs a node with whether it has children of its own,
+// as returned by GetChildrenWithHasChildren.
+type ExpandableNode[T any] struct {
+	Node        *Node[T] // The child node
+	HasChildren bool     // Whether the child can be expanded further
+}
+
+// GetChildrenWithHasChildren works like GetChildren but also reports for each
+// child whether it has children itself, e.g. to show expand controls in a
+// lazily loaded tree that fetches one level per request.
+// The grandchildren are not collected, each flag is a single map lookup.
+// Returns an empty slice if the node has no children.
+//
+// Example:
+//
+//	for _, child := range tree.GetChildrenWithHasChildren(parentID) {
+//	    renderRow(child.Node, child.HasChildren)
+//	}
+func (t *Tree[T]) GetChildrenWithHasChildren(id int) []ExpandableNode[T] {
+	t.rLockSortedChildren(id)
+	defer t.RUnlock()
+
+	children := t.children[id]
+	result := make([]ExpandableNode[T], len(children))
+	for i, child := range children {
+		result[i] = ExpandableNode[T]{Node: child, HasChildren: len(t.children[child.ID]) > 0}
+	}
+	return result
+}
+
+// HasMoreBelow reports whether the specified node has any children.
+// It is a cheap lookup in the children map, meant for lazy-loading UIs that
+// render only part of a subtree (e.g. with GetDescendants and a maxDepth) and
+// need to tell a true leaf from a node whose children were not loaded yet.
+// Returns false if the node doesn't exist.
+//
+// Example:
+//
+//	for _, node := range tree.GetDescendants(rootID, 2) {
+//	    renderRow(node, tree.HasMoreBelow(node.ID)) // show an expand arrow
+//	}
+func (t *Tree[T]) HasMoreBelow(id int) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	if _, exists := t.nodes[id]; !exists {
+		return false
+	}
+	return len(t.children[id]) > 0
+}
+
+// GetChildrenIDs returns all children IDs of the specified node.
+// Returns an empty slice if the node has no children.
+//
+// Example:
+//
+//	if ids := tree.GetChildrenIDs(parentID); len(ids) > 0 {
+//	    fmt.Printf("Child IDs: %v\n", ids)
+//	}
+func (t *Tree[T]) GetChildrenIDs(id int) []int {
+	children := t.GetChildren(id)
+	ids := make([]int, len(children))
+	for i, child := range children {
+		ids[i] = child.ID
+	}
+	return ids
+}
+
+// GetChildrenIDSet returns the IDs of the immediate children of the specified
+// node as a set, for repeated "is X a direct child of Y" checks.
+// Returns an empty set if the node has no children or doesn't exist,
+// matching GetDescendantsIDSet.
+//
+// Example:
+//
+//	direct := tree.GetChildrenIDSet(parentID)
+//	if direct[nodeID] {
+//	    fmt.Println("direct child")
+//	}
+func (t *Tree[T]) GetChildrenIDSet(id int) map[int]bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	children := t.children[id]
+	set := make(map[int]bool, len(children))
+	for _, child := range children {
+		set[child.ID] = true
+	}
+	return set
+}
+
+// GetChildrenWhere returns the immediate children of the specified node
+// whose data satisfies match, preserving the sorted order.
+// The result is a fresh slice, so modifying it never affects the tree.
+//
+// Example:
+//
+//	enabled := tree.GetChildrenWhere(menuID, func(item MenuItem) bool {
+//	    return !item.Disabled
+//	})
+func (t *Tree[T]) GetChildrenWhere(id int, match func(T) bool) []*Node[T] {
+	t.rLockSortedChildren(id)
+	defer t.RUnlock()
+
+	children := t.children[id]
+	result := make([]*Node[T], 0, len(children))
+	for _, child := range children {
+		if match(child.Data) {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// GetTopChildren returns at most n immediate children of the specified node
+// in sorted order, and whether further children were left out.
+// Only the returned children are copied, which keeps the call cheap for nodes
+// with many children. A non-positive n returns no children.
+//
+// Example:
+//
+//	children, more := tree.GetTopChildren(folderID, 5)
+//	render(children)
+//	if more {
+//	    renderMoreLink(folderID)
+//	}
+func (t *Tree[T]) GetTopChildren(id, n int) ([]*Node[T], bool) {
+	t.rLockSortedChildren(id)
+	defer t.RUnlock()
+
+	children := t.children[id]
+	n = max(0, min(n, len(children)))
+
+	top := make([]*Node[T], n)
+	copy(top, children)
+	return top, len(children) > n
+}
+
+// GetChildrenSorted returns a copy of the immediate children of the specified node
+// sorted by less, for one-off views that need an ordering other than the stored one.
+// The sort is stable, so children that compare equal keep their stored order.
+// The stored order of the tree is left intact.
+//
+// Example:
+//
+//	newestFirst := tree.GetChildrenSorted(folderID, func(a, b File) bool {
+//	    return a.ModTime.After(b.ModTime)
+//	})
+func (t *Tree[T]) GetChildrenSorted(id int, less func(a, b T) bool) []*Node[T] {
+	t.rLockSortedChildren(id)
+	children := make([]*Node[T], len(t.children[id]))
+	copy(children, t.children[id])
+	t.RUnlock()
+
+	sort.SliceStable(children, func(i, j int) bool {
+		return less(children[i].Data, children[j].Data)
+	})
+	return children
+}
+
+// GetAncestors returns all ancestor nodes of the specified node.
+// If includeSelf is true, the node itself will be included as the first element.
+// Returns nodes ordered from the node itself (if included) up to the root.
 //
 // Example:
 //
@@ -392,364 +1505,2911 @@ func (t *Tree[T]) GetChildrenIDs(id int) []int {
 //	    fmt.Printf("Ancestor: %v\n", ancestor.Data)
 //	}
 //
-// Example return structure for node ID 4 (Child 1.1):
+// Example return structure for node ID 4 (Child 1.1):
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},     // Parent
+//	    {ID: 1, ParentID: 0, Data: Category{Name: "Child 2"}}      // Grandparent
+//	]
+func (t *Tree[T]) GetAncestors(id int, includeSelf bool) []*Node[T] {
+	t.RLock()
+	defer t.RUnlock()
+
+	ancestors := make([]*Node[T], 0)
+	if includeSelf {
+		if node, exists := t.nodes[id]; exists {
+			ancestors = append(ancestors, node)
+		}
+	}
+
+	currentID := id
+	for {
+		node, exists := t.nodes[currentID]
+		if !exists || node.ParentID == 0 {
+			break
+		}
+		if parent, exists := t.nodes[node.ParentID]; exists {
+			ancestors = append(ancestors, parent)
+			currentID = parent.ID
+		} else {
+			break
+		}
+	}
+
+	return ancestors
+}
+
+// Ancestors returns an iterator over the ancestors of the specified node, in
+// the same order as GetAncestors: from the node itself (if includeSelf is
+// true) up to the root.
+//
+// The read lock is held from the start of the iteration until it ends or the
+// loop exits. The loop body must not call any method of the tree, not even a
+// read-only one such as FindNode: a write deadlocks at once, and taking the
+// read lock again deadlocks as soon as a writer is waiting. Use GetAncestors
+// if the body needs to query the tree.
+//
+// Example:
+//
+//	for ancestor := range tree.Ancestors(nodeID, false) {
+//	    if ancestor.Data.Hidden {
+//	        return false
+//	    }
+//	}
+func (t *Tree[T]) Ancestors(id int, includeSelf bool) iter.Seq[*Node[T]] {
+	return func(yield func(*Node[T]) bool) {
+		t.RLock()
+		defer t.RUnlock()
+
+		node, exists := t.nodes[id]
+		if !exists {
+			return
+		}
+		if includeSelf && !yield(node) {
+			return
+		}
+		for parent, ok := t.nodes[node.ParentID]; ok; parent, ok = t.nodes[parent.ParentID] {
+			if !yield(parent) {
+				return
+			}
+		}
+	}
+}
+
+// GetAncestorsUntil works like GetAncestors but stops walking up once it
+// reaches stopAtID, which is included in the result. This gives the ancestors
+// relative to a chosen root, e.g. for breadcrumbs scoped to a sub-catalog.
+// If the node itself is stopAtID, only the node is returned (with includeSelf)
+// or nothing. If stopAtID is not an ancestor, the full chain up to the root is
+// returned, as GetAncestors would.
+//
+// Example return structure for node ID 7 (Child 1.2.1) stopping at ID 2:
+//
+//	[
+//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}}, // Parent
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}}    // Stop node
+//	]
+func (t *Tree[T]) GetAncestorsUntil(id, stopAtID int, includeSelf bool) []*Node[T] {
+	t.RLock()
+	defer t.RUnlock()
+
+	ancestors := make([]*Node[T], 0)
+	node, exists := t.nodes[id]
+	if !exists {
+		return ancestors
+	}
+	if includeSelf {
+		ancestors = append(ancestors, node)
+	}
+
+	for node.ID != stopAtID {
+		node, exists = t.nodes[node.ParentID]
+		if !exists {
+			break
+		}
+		ancestors = append(ancestors, node)
+	}
+	return ancestors
+}
+
+// GetAncestorsRootFirst returns the same nodes as GetAncestors, but ordered
+// from the root down to the node itself (if included).
+// The result is allocated once with its final size and filled from the end,
+// so no reversal is needed. It mirrors GetNodePath but returns full nodes.
+//
+// Example return structure for node ID 4 (Child 1.1) with includeSelf true:
+//
+//	[
+//	    {ID: 1, ParentID: 0, Data: Category{Name: "Root"}},
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},
+//	    {ID: 4, ParentID: 2, Data: Category{Name: "Child 1.1"}}
+//	]
+func (t *Tree[T]) GetAncestorsRootFirst(id int, includeSelf bool) []*Node[T] {
+	t.RLock()
+	defer t.RUnlock()
+
+	node, exists := t.nodes[id]
+	if !exists {
+		return make([]*Node[T], 0)
+	}
+	if !includeSelf {
+		node, exists = t.nodes[node.ParentID]
+	}
+
+	// Count the chain first to allocate the exact size
+	count := 0
+	for current, ok := node, exists; ok; current, ok = t.nodes[current.ParentID] {
+		count++
+	}
+
+	ancestors := make([]*Node[T], count)
+	for current, ok := node, exists; ok; current, ok = t.nodes[current.ParentID] {
+		count--
+		ancestors[count] = current
+	}
+	return ancestors
+}
+
+// GetAncestorIDs returns all ancestor IDs of the specified node.
+// If includeSelf is true, the node's own ID will be included as the first element.
+// Returns IDs ordered from the node itself (if included) up to the root.
+//
+// Example return structure for node ID 4 (Child 1.1):
+//
+//	[2, 1] // 2 is the parent ID of 4, 1 is the grandparent ID of 4
+func (t *Tree[T]) GetAncestorIDs(id int, includeSelf bool) []int {
+	ancestors := t.GetAncestors(id, includeSelf)
+	ancestorIDs := make([]int, len(ancestors))
+	for i, ancestor := range ancestors {
+		ancestorIDs[i] = ancestor.ID
+	}
+	return ancestorIDs
+}
+
+// GetNodePath returns the path of node IDs from the root to the specified node.
+// Returns IDs ordered from the root down to the node.
+//
+// Example:
+//
+//	path := tree.GetNodePath(nodeID, true)
+//	fmt.Printf("Node path: %v\n", path)
+//
+// Example return structure for node ID 4 (Child 1.1):
+//
+//	[1, 2, 4] // 1 is the root, 2 is the parent of 4
+func (t *Tree[T]) GetNodePath(id int, includeSelf bool) []int {
+	ancestors := t.GetAncestors(id, includeSelf)
+	ancestorIDs := make([]int, len(ancestors))
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestorIDs[len(ancestors)-1-i] = ancestors[i].ID
+	}
+	return ancestorIDs
+}
+
+// AllPaths returns the root-to-node ID path of every node, keyed by node ID.
+// The paths are computed in a single depth-first pass that extends each
+// parent's path, so the cost is proportional to the total path length instead
+// of walking the ancestors of every node as GetNodePath does.
+// Each path is a separate slice that can be modified freely.
+//
+// Example return structure for the tree Root -> (Child 1 -> Child 1.1):
+//
+//	map[int][]int{
+//	    1: {1},
+//	    2: {1, 2},
+//	    4: {1, 2, 4},
+//	}
+func (t *Tree[T]) AllPaths() map[int][]int {
+	t.RLock()
+	defer t.RUnlock()
+
+	paths := make(map[int][]int, len(t.nodes))
+	stack := append([]*Node[T](nil), t.children[0]...)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Parents are always visited first, roots have no parent path
+		parentPath := paths[node.ParentID]
+		path := make([]int, len(parentPath)+1)
+		copy(path, parentPath)
+		path[len(parentPath)] = node.ID
+		paths[node.ID] = path
+
+		stack = append(stack, t.children[node.ID]...)
+	}
+	return paths
+}
+
+// GetBranchTo returns the chain of nodes leading from ancestorID down to descendantID,
+// both inclusive. It is the downward counterpart of GetAncestors.
+// If ancestorID equals descendantID, the chain holds just that node.
+// Returns an empty slice and false if either node doesn't exist or
+// descendantID is not located under ancestorID.
+//
+// Example return structure for ancestor ID 2 and descendant ID 7:
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},
+//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}},
+//	    {ID: 7, ParentID: 5, Data: Category{Name: "Child 1.2.1"}}
+//	]
+func (t *Tree[T]) GetBranchTo(ancestorID, descendantID int) ([]*Node[T], bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if _, exists := t.nodes[ancestorID]; !exists {
+		return make([]*Node[T], 0), false
+	}
+
+	// Walk up from the descendant until the ancestor is reached
+	branch := make([]*Node[T], 0)
+	node, exists := t.nodes[descendantID]
+	for exists {
+		branch = append(branch, node)
+		if node.ID == ancestorID {
+			// Reverse to get ancestor-first order
+			for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+				branch[i], branch[j] = branch[j], branch[i]
+			}
+			return branch, true
+		}
+		node, exists = t.nodes[node.ParentID]
+	}
+	return make([]*Node[T], 0), false
+}
+
+// GetDepth returns the distance from the root to the specified node, following
+// its ancestor chain: 0 for a root, 1 for its children, and so on.
+// Returns -1 if the node doesn't exist.
+//
+// Example:
+//
+//	fmt.Printf("This category is %d levels deep\n", tree.GetDepth(nodeID))
+func (t *Tree[T]) GetDepth(id int) int {
+	t.RLock()
+	defer t.RUnlock()
+
+	node, exists := t.nodes[id]
+	if !exists {
+		return -1
+	}
+	depth := 0
+	for parent, ok := t.nodes[node.ParentID]; ok; parent, ok = t.nodes[parent.ParentID] {
+		depth++
+	}
+	return depth
+}
+
+// GetHeight returns the length of the longest downward path from the
+// specified node to a leaf: 0 for a leaf, 1 if it only has leaf children,
+// and so on. Returns -1 if the node doesn't exist.
+//
+// Example:
+//
+//	fmt.Printf("Its subtree is %d levels tall\n", tree.GetHeight(nodeID))
+func (t *Tree[T]) GetHeight(id int) int {
+	t.RLock()
+	defer t.RUnlock()
+
+	node, exists := t.nodes[id]
+	if !exists {
+		return -1
+	}
+	// One width per level, the node's own level included
+	return len(t.levelWidths([]*Node[T]{node})) - 1
+}
+
+// GetAncestorIDAtDepth returns the ancestor ID of the specified node at a given depth.
+// Parameters:
+//   - id: The node ID whose ancestor to find
+//   - depth: How many levels up to traverse
+//   - fromRoot: If true, counts depth from root down; if false, counts from node up
+//
+// Returns 0 if:
+//   - The node doesn't exist
+//   - The depth is invalid
+//   - No ancestor exists at the specified depth
+//
+// Example:
+//
+//	// Get parent's parent (depth=2, counting up from node)
+//	grandparentID := tree.GetAncestorIDAtDepth(nodeID, 2, false)
+//
+//	// Get second level node (depth=2, counting down from root)
+//	secondLevelID := tree.GetAncestorIDAtDepth(nodeID, 2, true)
+func (t *Tree[T]) GetAncestorIDAtDepth(id int, depth int, fromRoot bool) int {
+	parentIDs := t.GetAncestorIDs(id, false)
+	if depth > len(parentIDs) || depth <= 0 || len(parentIDs) == 0 {
+		return 0
+	}
+	if fromRoot {
+		return parentIDs[depth-1]
+	}
+	return parentIDs[len(parentIDs)-depth]
+}
+
+// Depth limits accepted by GetDescendants and the other maxDepth parameters.
+const (
+	// DepthUnlimited traverses all levels below the node.
+	DepthUnlimited = 0
+	// DepthNone returns no descendants at all.
+	DepthNone = -1
+)
+
+// CountNodes returns the total number of nodes in the tree.
+func (t *Tree[T]) CountNodes() int {
+	t.RLock()
+	defer t.RUnlock()
+	return len(t.nodes)
+}
+
+// CountDescendants returns the number of descendants of the specified node,
+// not counting the node itself, without collecting them into a slice.
+// Returns 0 for a leaf and -1 if the node doesn't exist.
+//
+// Example:
+//
+//	fmt.Printf("%d items in this category\n", tree.CountDescendants(nodeID))
+func (t *Tree[T]) CountDescendants(id int) int {
+	t.RLock()
+	defer t.RUnlock()
+
+	if _, exists := t.nodes[id]; !exists {
+		return -1
+	}
+	count := 0
+	stack := []int{id}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, child := range t.children[current] {
+			count++
+			stack = append(stack, child.ID)
+		}
+	}
+	return count
+}
+
+// GetAllDescendants returns every descendant of the specified node in
+// depth-first order. It is shorthand for GetDescendants(id, DepthUnlimited).
+//
+// Example:
+//
+//	for _, desc := range tree.GetAllDescendants(nodeID) {
+//	    fmt.Printf("Descendant: %v\n", desc.Data)
+//	}
+func (t *Tree[T]) GetAllDescendants(id int) []*Node[T] {
+	return t.GetDescendants(id, DepthUnlimited)
+}
+
+// GetDirectDescendants returns the descendants one level below the specified
+// node, i.e. its immediate children in sorted order.
+// It is shorthand for GetDescendants(id, 1).
+//
+// Example:
+//
+//	for _, child := range tree.GetDirectDescendants(nodeID) {
+//	    fmt.Printf("Child: %v\n", child.Data)
+//	}
+func (t *Tree[T]) GetDirectDescendants(id int) []*Node[T] {
+	return t.GetDescendants(id, 1)
+}
+
+// GetDescendants returns all descendant nodes of the specified node up to maxDepth.
+// The nodes are returned in depth-first order.
+//
+// Parameters:
+//   - id: The node ID whose descendants to retrieve
+//   - maxDepth: Maximum depth to traverse (DepthUnlimited (0) for unlimited,
+//     DepthNone or any negative value for none)
+//
+// Example:
+//
+//	// Get all descendants up to 2 levels deep
+//	descendants := tree.GetDescendants(nodeID, 2)
+//	for _, desc := range descendants {
+//	    fmt.Printf("Descendant: %v\n", desc.Data)
+//	}
+//
+// Example return structure for node ID 1 with maxDepth 3:
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},     // Level 1
+//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}},     // Level 1
+//	    {ID: 4, ParentID: 2, Data: Category{Name: "Child 1.1"}},   // Level 2
+//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}},   // Level 2
+//	    {ID: 7, ParentID: 5, Data: Category{Name: "Child 1.2.1"}}, // Level 3
+//	    {ID: 8, ParentID: 5, Data: Category{Name: "Child 1.2.2"}}, // Level 3
+//	    {ID: 6, ParentID: 3, Data: Category{Name: "Child 2.1"}}    // Level 2
+//	]
+func (t *Tree[T]) GetDescendants(id int, maxDepth int) []*Node[T] {
+	if maxDepth < 0 {
+		return make([]*Node[T], 0)
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+	return t.collectDescendants(id, maxDepth)
+}
+
+// GetDescendantsCtx works like GetDescendants but stops early once ctx is
+// cancelled or its deadline passes, e.g. when the client of an HTTP handler
+// disconnects during a traversal of a very large tree. The context is checked
+// before the traversal and then about every 1024 nodes, so the overhead is low.
+// Returns nil and ctx.Err() if the traversal was stopped. Otherwise the
+// result is exactly that of GetDescendants, including the empty slice for a
+// missing node.
+//
+// Example:
+//
+//	descendants, err := tree.GetDescendantsCtx(r.Context(), rootID, DepthUnlimited)
+//	if err != nil {
+//	    return // client went away
+//	}
+func (t *Tree[T]) GetDescendantsCtx(ctx context.Context, id int, maxDepth int) ([]*Node[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if maxDepth < 0 {
+		return make([]*Node[T], 0), nil
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+	return t.collectDescendantsCtx(ctx, id, maxDepth)
+}
+
+// GetDescendantsFiltered returns the descendants of the specified node for
+// which keep returns true, in the same order and with the same maxDepth
+// convention as GetDescendants. Nodes that don't match are left out, but
+// their children are still visited up to maxDepth.
+// Unlike GetAll, only the subtree of the node is searched, and the result
+// is ordered. keep runs under the read lock, so it must not call any method
+// of the tree, not even a read-only one: taking the read lock again
+// deadlocks as soon as a writer is waiting.
+// Returns an empty slice if the node doesn't exist or nothing matches.
+//
+// Example:
+//
+//	// Active categories up to 3 levels below the node
+//	active := tree.GetDescendantsFiltered(nodeID, 3, func(c Category) bool {
+//	    return c.Active
+//	})
+func (t *Tree[T]) GetDescendantsFiltered(id int, maxDepth int, keep func(T) bool) []*Node[T] {
+	if maxDepth < 0 {
+		return make([]*Node[T], 0)
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	// collectDescendants returns a fresh slice, so it can be filtered in place
+	return slices.DeleteFunc(t.collectDescendants(id, maxDepth), func(node *Node[T]) bool {
+		return !keep(node.Data)
+	})
+}
+
+// Descendants returns an iterator over the descendants of the specified node,
+// in the same order and with the same maxDepth convention as GetDescendants.
+// Nodes are produced lazily, so breaking out of the loop early skips the rest
+// of the traversal and no result slice is allocated.
+//
+// The read lock is held from the start of the iteration until it ends or the
+// loop exits. The loop body must not call any method of the tree, not even a
+// read-only one such as FindNode: a write deadlocks at once, and taking the
+// read lock again deadlocks as soon as a writer is waiting. Use GetDescendants
+// if the body needs to query the tree.
+//
+// Example:
+//
+//	for node := range tree.Descendants(rootID, DepthUnlimited) {
+//	    if node.Data.Name == "Target" {
+//	        break
+//	    }
+//	}
+func (t *Tree[T]) Descendants(id int, maxDepth int) iter.Seq[*Node[T]] {
+	return func(yield func(*Node[T]) bool) {
+		if maxDepth < 0 {
+			return
+		}
+
+		t.rLockSorted()
+		defer t.RUnlock()
+
+		type frame struct {
+			id    int
+			depth int
+		}
+		stack := []frame{{id: id, depth: 0}}
+		for len(stack) > 0 {
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if maxDepth > 0 && current.depth >= maxDepth {
+				continue
+			}
+
+			// Yield all children first, then descend, as collectDescendants does
+			children := t.children[current.id]
+			for _, child := range children {
+				if !yield(child) {
+					return
+				}
+			}
+			for i := len(children) - 1; i >= 0; i-- {
+				stack = append(stack, frame{id: children[i].ID, depth: current.depth + 1})
+			}
+		}
+	}
+}
+
+// GetDescendantsBFS works like GetDescendants, with the same maxDepth
+// convention, but returns the descendants in breadth-first order: all nodes
+// of one level before any node of the next, e.g. to render an org chart one
+// rank per row. Within a level, nodes follow the sorted sibling order.
+// The visitation order is the only difference from GetDescendants; both
+// return the same set of nodes.
+//
+// Example return structure for node ID 1 with maxDepth 0:
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},     // Level 1
+//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}},     // Level 1
+//	    {ID: 4, ParentID: 2, Data: Category{Name: "Child 1.1"}},   // Level 2
+//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}},   // Level 2
+//	    {ID: 6, ParentID: 3, Data: Category{Name: "Child 2.1"}},   // Level 2
+//	    {ID: 7, ParentID: 5, Data: Category{Name: "Child 1.2.1"}}, // Level 3
+//	    {ID: 8, ParentID: 5, Data: Category{Name: "Child 1.2.2"}}  // Level 3
+//	]
+func (t *Tree[T]) GetDescendantsBFS(id int, maxDepth int) []*Node[T] {
+	result := make([]*Node[T], 0)
+	if maxDepth < 0 {
+		return result
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	// The result doubles as the BFS queue, levelEnd marks where the next level starts
+	result = append(result, t.children[id]...)
+	depth, levelEnd := 1, len(result)
+	for next := 0; next < len(result); next++ {
+		if next == levelEnd {
+			depth, levelEnd = depth+1, len(result)
+		}
+		if maxDepth > 0 && depth >= maxDepth {
+			break
+		}
+		result = append(result, t.children[result[next].ID]...)
+	}
+	return result
+}
+
+// GetDescendantsCapped returns up to maxNodes descendants of the specified
+// node, regardless of their depth, e.g. for a bounded preview of a subtree.
+//
+// The subtree is traversed breadth-first, so the result is ordered level by
+// level, with siblings in sorted order within each level. A cap therefore
+// keeps the shallowest nodes, which gives a more representative sample of
+// unevenly shaped subtrees than a depth limit.
+// Returns an empty slice if maxNodes is not positive or the node has no
+// descendants.
+//
+// Example:
+//
+//	// Preview at most 100 nodes of a large category
+//	preview := tree.GetDescendantsCapped(nodeID, 100)
+//
+// Example return structure for node ID 1 with maxNodes 5:
+//
+//	[
+//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},   // Level 1
+//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}},   // Level 1
+//	    {ID: 4, ParentID: 2, Data: Category{Name: "Child 1.1"}}, // Level 2
+//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}}, // Level 2
+//	    {ID: 6, ParentID: 3, Data: Category{Name: "Child 2.1"}}  // Level 2
+//	]
+func (t *Tree[T]) GetDescendantsCapped(id, maxNodes int) []*Node[T] {
+	result := make([]*Node[T], 0)
+	if maxNodes <= 0 {
+		return result
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	// The result doubles as the BFS queue
+	result = append(result, t.children[id]...)
+	for next := 0; next < len(result) && len(result) < maxNodes; next++ {
+		result = append(result, t.children[result[next].ID]...)
+	}
+	if len(result) > maxNodes {
+		result = result[:maxNodes]
+	}
+	return result
+}
+
+// parallelThreshold is the minimum number of nodes in the tree for
+// GetDescendantsParallel to spread the traversal across goroutines.
+// Below it, the goroutine overhead outweighs the gain.
+const parallelThreshold = 4096
+
+// GetDescendantsParallel works like GetDescendants but traverses the subtrees
+// of the node's children on up to workers goroutines, for flattening very
+// large subtrees. The partial results are merged in the order of the children,
+// so the result is deterministic and identical to GetDescendants: the direct
+// children first, then the descendants of each child grouped by child.
+//
+// The traversal runs serially if workers is less than 2, the node has fewer
+// than two children, or the tree holds fewer than 4096 nodes.
+// The read lock is held for the whole traversal.
+//
+// Example:
+//
+//	rows := tree.GetDescendantsParallel(rootID, 0, runtime.GOMAXPROCS(0))
+func (t *Tree[T]) GetDescendantsParallel(id int, maxDepth int, workers int) []*Node[T] {
+	if maxDepth < 0 {
+		return make([]*Node[T], 0)
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	children := t.children[id]
+	if workers < 2 || len(children) < 2 || len(t.nodes) < parallelThreshold {
+		return t.collectDescendants(id, maxDepth)
+	}
+
+	// A maxDepth of 1 stops at the children, 0 stays unlimited below them
+	if maxDepth == 1 {
+		return slices.Clone(children)
+	}
+	subDepth := 0
+	if maxDepth > 0 {
+		subDepth = maxDepth - 1
+	}
+
+	parts := make([][]*Node[T], len(children))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(children)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				parts[i] = t.collectDescendants(children[i].ID, subDepth)
+			}
+		}()
+	}
+	for i := range children {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	total := len(children)
+	for _, part := range parts {
+		total += len(part)
+	}
+	descendants := make([]*Node[T], 0, total)
+	descendants = append(descendants, children...)
+	for _, part := range parts {
+		descendants = append(descendants, part...)
+	}
+	return descendants
+}
+
+// collectDescendants builds the list of descendants for a given node.
+// It uses an explicit stack instead of recursion so that very deep trees
+// cannot exhaust the goroutine stack.
+//
+// When a node is visited, all of its children are appended at once,
+// then each child is visited in order. This yields the same ordering
+// as expanding children lists depth-first.
+func (t *Tree[T]) collectDescendants(id, maxDepth int) []*Node[T] {
+	descendants, _ := t.collectDescendantsCtx(context.Background(), id, maxDepth)
+	return descendants
+}
+
+// ctxCheckInterval is the number of nodes the context-aware traversals
+// visit between checks of their context.
+const ctxCheckInterval = 1024
+
+// collectDescendantsCtx works like collectDescendants but checks ctx before
+// the traversal and then about every ctxCheckInterval collected nodes,
+// returning nil and the context's error once it is done.
+func (t *Tree[T]) collectDescendantsCtx(ctx context.Context, id, maxDepth int) ([]*Node[T], error) {
+	type frame struct {
+		id    int
+		depth int
+	}
+
+	descendants := make([]*Node[T], 0)
+	stack := []frame{{id: id, depth: 0}}
+	nextCheck := 0
+	for len(stack) > 0 {
+		if len(descendants) >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			nextCheck = len(descendants) + ctxCheckInterval
+		}
+
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if maxDepth > 0 && current.depth >= maxDepth {
+			continue
+		}
+
+		children := t.children[current.id]
+		if len(children) == 0 {
+			continue
+		}
+		descendants = append(descendants, children...)
+
+		// Push in reverse so the first child is visited first
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{id: children[i].ID, depth: current.depth + 1})
+		}
+	}
+
+	return descendants, nil
+}
+
+// DepthNode pairs a node with its depth relative to a query node,
+// as returned by GetDescendantsWithDepth.
+type DepthNode[T any] struct {
+	Node  *Node[T] // The descendant node
+	Depth int      // Levels below the query node (1 for direct children)
+}
+
+// GetDescendantsWithDepth works like GetDescendants but also reports each
+// descendant's depth relative to the specified node, so callers don't need
+// to walk the ancestors of every result to indent it.
+// Parameters and ordering follow the same rules as GetDescendants.
+//
+// Example:
+//
+//	for _, d := range tree.GetDescendantsWithDepth(nodeID, 0) {
+//	    fmt.Printf("%s%v\n", strings.Repeat("  ", d.Depth-1), d.Node.Data)
+//	}
+func (t *Tree[T]) GetDescendantsWithDepth(id, maxDepth int) []DepthNode[T] {
+	if maxDepth < 0 {
+		return make([]DepthNode[T], 0)
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	type frame struct {
+		id    int
+		depth int
+	}
+
+	// Same traversal as collectDescendants, recording the depth of each child
+	descendants := make([]DepthNode[T], 0)
+	stack := []frame{{id: id, depth: 0}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if maxDepth > 0 && current.depth >= maxDepth {
+			continue
+		}
+
+		children := t.children[current.id]
+		for _, child := range children {
+			descendants = append(descendants, DepthNode[T]{Node: child, Depth: current.depth + 1})
+		}
+
+		// Push in reverse so the first child is visited first
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{id: children[i].ID, depth: current.depth + 1})
+		}
+	}
+
+	return descendants
+}
+
+// GetDescendantsGated returns the descendants of the specified node, where the
+// children of each node are included only if canDescend returns true for that
+// node. The gate applies to the starting node as well, so a closed start node
+// yields no descendants.
+//
+// This differs from a stop condition: a node failing canDescend is still part
+// of the result (if its parent was open), only its subtree is hidden. It suits
+// views where a node is visible but its contents are not, such as ACL-scoped
+// folders. The order follows the same rules as GetDescendants.
+//
+// Example:
+//
+//	visible := tree.GetDescendantsGated(rootID, func(f Folder) bool {
+//	    return user.CanList(f)
+//	})
+func (t *Tree[T]) GetDescendantsGated(id int, canDescend func(T) bool) []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	descendants := make([]*Node[T], 0)
+	start, exists := t.nodes[id]
+	if !exists || !canDescend(start.Data) {
+		return descendants
+	}
+
+	stack := []int{id}
+	for len(stack) > 0 {
+		parentID := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		children := t.children[parentID]
+		descendants = append(descendants, children...)
+
+		// Push open children in reverse so the first child is visited first
+		for i := len(children) - 1; i >= 0; i-- {
+			if canDescend(children[i].Data) {
+				stack = append(stack, children[i].ID)
+			}
+		}
+	}
+	return descendants
+}
+
+// GetDescendantsIDs returns all descendant IDs of the specified node.
+// Parameters follow the same rules as GetDescendants.
+//
+// Example:
+//
+//	// Get IDs of all descendants up to 2 levels deep
+//	descendantIDs := tree.GetDescendantsIDs(nodeID, 2)
+//	fmt.Printf("Descendant IDs: %v\n", descendantIDs)
+func (t *Tree[T]) GetDescendantsIDs(id int, maxDepth int) []int {
+	descendants := t.GetDescendants(id, maxDepth)
+	ids := make([]int, len(descendants))
+	for i, descendant := range descendants {
+		ids[i] = descendant.ID
+	}
+	return ids
+}
+
+// GetDescendantsIDSet returns the descendant IDs of the specified node as a set,
+// which is handy for repeated "is X inside this subtree" checks.
+// Parameters follow the same rules as GetDescendants.
+// Returns an empty set for a negative maxDepth or if there are no descendants.
+//
+// Example:
+//
+//	selected := tree.GetDescendantsIDSet(folderID, 0)
+//	for _, file := range files {
+//	    if selected[file.FolderID] {
+//	        export(file)
+//	    }
+//	}
+func (t *Tree[T]) GetDescendantsIDSet(id, maxDepth int) map[int]bool {
+	if maxDepth < 0 {
+		return make(map[int]bool)
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	type frame struct {
+		id    int
+		depth int
+	}
+
+	set := make(map[int]bool)
+	stack := []frame{{id: id, depth: 0}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if maxDepth > 0 && current.depth >= maxDepth {
+			continue
+		}
+		for _, child := range t.children[current.id] {
+			set[child.ID] = true
+			stack = append(stack, frame{id: child.ID, depth: current.depth + 1})
+		}
+	}
+	return set
+}
+
+// GetDescendantsBudget returns the descendants of the specified node in
+// pre-order (the order in which FormatTreeDisplay renders them) until the
+// accumulated cost reaches the budget.
+// The traversal stops at the first node whose cost would push the total
+// above budget; that node is excluded from the result.
+//
+// Example:
+//
+//	// Load at most 50 rendered rows, each node taking one row
+//	rows := tree.GetDescendantsBudget(folderID, func(Category) int { return 1 }, 50)
+func (t *Tree[T]) GetDescendantsBudget(id int, cost func(T) int, budget int) []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make([]*Node[T], 0)
+	total := 0
+
+	// pushChildren pushes in reverse so the first child is visited first
+	var stack []*Node[T]
+	pushChildren := func(parentID int) {
+		children := t.children[parentID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
+	}
+	pushChildren(id)
+
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		c := cost(node.Data)
+		if total+c > budget {
+			break
+		}
+		total += c
+		result = append(result, node)
+		pushChildren(node.ID)
+	}
+	return result
+}
+
+// ChildrenMap returns a snapshot of the children lists of the whole forest,
+// keyed by parent ID. The root nodes are listed under key 0.
+// Each value is a fresh slice in sorted order, while the nodes themselves are
+// shared with the tree. Later changes to the tree are not reflected in the
+// returned map, and modifying the map or its slices never affects the tree.
+//
+// Example:
+//
+//	children := tree.ChildrenMap()
+//	for _, root := range children[0] {
+//	    render(root, children)
+//	}
+func (t *Tree[T]) ChildrenMap() map[int][]*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make(map[int][]*Node[T], len(t.children))
+	for parentID, children := range t.children {
+		result[parentID] = slices.Clone(children)
+	}
+	return result
+}
+
+// GetSubtreeChildrenMap returns the children data of every node in the subtree
+// rooted at rootID, keyed by parent ID. Each value holds the children's data in
+// sorted order. Only nodes that have children appear as keys.
+// Returns an empty map if the root node doesn't exist.
+//
+// This is an intermediate form between the flat GetDescendants list and the
+// fully nested ToTree structure.
+//
+// Example return structure for root ID 2:
+//
+//	map[int][]Category{
+//	    2: {{Name: "Child 1.1"}, {Name: "Child 1.2"}},
+//	    5: {{Name: "Child 1.2.1"}, {Name: "Child 1.2.2"}},
+//	}
+func (t *Tree[T]) GetSubtreeChildrenMap(rootID int) map[int][]T {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make(map[int][]T)
+	if _, exists := t.nodes[rootID]; !exists {
+		return result
+	}
+
+	stack := []int{rootID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		children := t.children[id]
+		if len(children) == 0 {
+			continue
+		}
+
+		data := make([]T, len(children))
+		for i, child := range children {
+			data[i] = child.Data
+			stack = append(stack, child.ID)
+		}
+		result[id] = data
+	}
+	return result
+}
+
+// WalkPostOrder visits the subtree rooted at rootID in post-order: every node's
+// children are visited, in sorted order, before the node itself, which makes it
+// suitable for bottom-up work such as deleting files before their folder.
+// The root is visited last at depth 0, its children at depth 1, and so on.
+// The walk stops as soon as visit returns false.
+// Nothing is visited if the root node doesn't exist.
+//
+// The read lock is held during the walk, so visit must not call any method of
+// the tree, not even a read-only one: taking the read lock again deadlocks as
+// soon as a writer is waiting.
+//
+// Example:
+//
+//	tree.WalkPostOrder(folderID, func(node *Node[File], depth int) bool {
+//	    return os.Remove(node.Data.Path) == nil
+//	})
+func (t *Tree[T]) WalkPostOrder(rootID int, visit func(node *Node[T], depth int) bool) {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return
+	}
+
+	type frame struct {
+		node     *Node[T]
+		depth    int
+		expanded bool // Whether the children have been pushed already
+	}
+
+	stack := []frame{{node: root}}
+	for len(stack) > 0 {
+		current := &stack[len(stack)-1]
+		if current.expanded {
+			stack = stack[:len(stack)-1]
+			if !visit(current.node, current.depth) {
+				return
+			}
+			continue
+		}
+
+		// Revisit the node once its children are done
+		current.expanded = true
+		node, depth := current.node, current.depth
+		children := t.children[node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{node: children[i], depth: depth + 1})
+		}
+	}
+}
+
+// GetSiblings returns all sibling nodes of the specified node.
+// If includeSelf is true, the node itself will be included in the result.
+// The result is always a fresh slice, so reordering it never affects the tree.
+// Returns an empty slice if the node doesn't exist.
+//
+// Example:
+//
+//	// Get all siblings excluding self
+//	siblings := tree.GetSiblings(nodeID, false)
+//	for _, sibling := range siblings {
+//	    fmt.Printf("Sibling: %v\n", sibling.Data)
+//	}
+func (t *Tree[T]) GetSiblings(id int, includeSelf bool) []*Node[T] {
+	// Like rLockSortedChildren, but the parent is only known under the lock
+	var node *Node[T]
+	var exists bool
+	for {
+		t.RLock()
+		node, exists = t.nodes[id]
+		if !exists || !t.unsorted[node.ParentID] {
+			break
+		}
+		t.RUnlock()
+
+		t.Lock()
+		t.sortChildren(node.ParentID)
+		t.Unlock()
+	}
+	defer t.RUnlock()
+
+	if !exists {
+		return make([]*Node[T], 0)
+	}
+
+	siblings := t.children[node.ParentID]
+	if !includeSelf {
+		// Filter out self from siblings
+		filtered := make([]*Node[T], 0, len(siblings)-1)
+		for _, sibling := range siblings {
+			if sibling.ID != id {
+				filtered = append(filtered, sibling)
+			}
+		}
+		return filtered
+	}
+
+	// Copy so callers can't reorder the internal children list
+	result := make([]*Node[T], len(siblings))
+	copy(result, siblings)
+	return result
+}
+
+// GetSiblingsIDs returns all sibling IDs of the specified node.
+// If includeSelf is true, the node's own ID will be included in the result.
+// Returns an empty slice if the node doesn't exist.
+func (t *Tree[T]) GetSiblingsIDs(id int, includeSelf bool) []int {
+	siblings := t.GetSiblings(id, includeSelf)
+	ids := make([]int, len(siblings))
+	for i, sibling := range siblings {
+		ids[i] = sibling.ID
+	}
+	return ids
+}
+
+// GetSiblingsSplit returns the siblings of the specified node split around its
+// position in the sorted order: before holds the siblings sorted ahead of the node,
+// after holds the ones sorted behind it. The node itself is excluded.
+// Both slices are fresh copies. Returns two empty slices and ok == false
+// if the node doesn't exist.
+//
+// Example:
+//
+//	before, after, ok := tree.GetSiblingsSplit(nodeID)
+//	if ok && len(before) == 0 {
+//	    fmt.Println("already at the top")
+//	}
+func (t *Tree[T]) GetSiblingsSplit(id int) (before, after []*Node[T], ok bool) {
+	t.RLock()
+	node, exists := t.nodes[id]
+	t.RUnlock()
+	if !exists {
+		return make([]*Node[T], 0), make([]*Node[T], 0), false
+	}
+
+	t.rLockSortedChildren(node.ParentID)
+	defer t.RUnlock()
+
+	siblings := t.children[node.ParentID]
+	for i, sibling := range siblings {
+		if sibling.ID == id {
+			before = make([]*Node[T], i)
+			copy(before, siblings[:i])
+			after = make([]*Node[T], len(siblings)-i-1)
+			copy(after, siblings[i+1:])
+			return before, after, true
+		}
+	}
+	return make([]*Node[T], 0), make([]*Node[T], 0), false
+}
+
+// AreSiblings reports whether a and b are distinct nodes sharing the same parent.
+// Root nodes (ParentID 0) are siblings of each other.
+// Returns false if either node doesn't exist or if a == b.
+func (t *Tree[T]) AreSiblings(a, b int) bool {
+	if a == b {
+		return false
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	nodeA, exists := t.nodes[a]
+	if !exists {
+		return false
+	}
+	nodeB, exists := t.nodes[b]
+	if !exists {
+		return false
+	}
+	return nodeA.ParentID == nodeB.ParentID
+}
+
+// IsAncestor reports whether ancestorID is a proper ancestor of nodeID, at any
+// depth, e.g. for permission inheritance. It walks up the parent chain of
+// nodeID without allocating. A node is not its own ancestor.
+// Returns false if either node doesn't exist.
+//
+// Example:
+//
+//	if tree.IsAncestor(grantedFolderID, fileID) {
+//	    // The permission on the folder applies to the file
+//	}
+func (t *Tree[T]) IsAncestor(ancestorID, nodeID int) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	_, ancestorExists := t.nodes[ancestorID]
+	_, nodeExists := t.nodes[nodeID]
+	return ancestorExists && nodeExists && t.isAncestor(ancestorID, nodeID)
+}
+
+// IsDescendant reports whether descendantID is a proper descendant of nodeID,
+// at any depth. It is IsAncestor with the arguments swapped.
+// Returns false if either node doesn't exist.
+func (t *Tree[T]) IsDescendant(descendantID, nodeID int) bool {
+	return t.IsAncestor(nodeID, descendantID)
+}
+
+// Relation describes how one node relates to another, as returned by Relationship.
+type Relation int
+
+const (
+	RelationUnrelated  Relation = iota // No relation, or either node doesn't exist
+	RelationSelf                       // Both IDs refer to the same node
+	RelationAncestor                   // The first node is an ancestor of the second
+	RelationDescendant                 // The first node is a descendant of the second
+	RelationSibling                    // Distinct nodes sharing the same parent
+)
+
+// String returns the name of the relation, e.g. "ancestor".
+func (r Relation) String() string {
+	switch r {
+	case RelationSelf:
+		return "self"
+	case RelationAncestor:
+		return "ancestor"
+	case RelationDescendant:
+		return "descendant"
+	case RelationSibling:
+		return "sibling"
+	default:
+		return "unrelated"
+	}
+}
+
+// Relationship classifies how node a relates to node b in a single call.
+// The checks are applied in this order, so the first matching relation wins:
+//   - RelationSelf if a == b
+//   - RelationAncestor if a is an ancestor of b (at any depth)
+//   - RelationDescendant if a is a descendant of b (at any depth)
+//   - RelationSibling if a and b share the same parent, as in AreSiblings
+//   - RelationUnrelated otherwise, or if either node doesn't exist
+//
+// Example:
+//
+//	switch tree.Relationship(managerID, employeeID) {
+//	case tree.RelationAncestor:
+//	    fmt.Println("reports up to the manager")
+//	case tree.RelationSibling:
+//	    fmt.Println("peer of the manager")
+//	}
+func (t *Tree[T]) Relationship(a, b int) Relation {
+	t.RLock()
+	defer t.RUnlock()
+
+	nodeA, exists := t.nodes[a]
+	if !exists {
+		return RelationUnrelated
+	}
+	nodeB, exists := t.nodes[b]
+	if !exists {
+		return RelationUnrelated
+	}
+
+	switch {
+	case a == b:
+		return RelationSelf
+	case t.isAncestor(a, b):
+		return RelationAncestor
+	case t.isAncestor(b, a):
+		return RelationDescendant
+	case nodeA.ParentID == nodeB.ParentID:
+		return RelationSibling
+	default:
+		return RelationUnrelated
+	}
+}
+
+// isAncestor reports whether ancestorID is a proper ancestor of id.
+// Both nodes must exist. The caller must hold the read or write lock.
+func (t *Tree[T]) isAncestor(ancestorID, id int) bool {
+	for currentID := t.nodes[id].ParentID; currentID != 0; currentID = t.nodes[currentID].ParentID {
+		if currentID == ancestorID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOne returns the first node that matches the given condition.
+// Nodes are visited in depth-first pre-order over the sorted forest, so if
+// several nodes match, the topmost, leftmost one is returned, the same as
+// with FindFirstInOrder.
+// Returns nil if no match is found.
+//
+// Example:
+//
+//	node := tree.GetOne(func(data Category) bool {
+//	    return data.Name == "Target"
+//	})
+//	if node != nil {
+//	    fmt.Printf("Found: %v\n", node.Data)
+//	}
+func (t *Tree[T]) GetOne(matcher func(T) bool) *Node[T] {
+	return t.FindFirstInOrder(matcher)
+}
+
+// GetOneNode works like GetOne, but the matcher receives the node instead of
+// its data, so it can match on structure such as the parent ID or whether
+// the node is a leaf. The node passed to the matcher is a view with Children
+// set to the node's sorted children; it is only valid during the call and
+// must not be modified. The returned node is the stored node, without
+// Children. The matcher runs under the read lock, so it must not call any
+// method of the tree, not even a read-only one: taking the read lock again
+// deadlocks as soon as a writer is waiting.
+// Like GetOne, the first match in pre-order is returned.
+// Returns nil if no match is found.
+//
+// Example:
+//
+//	// A leaf directly below node 5
+//	node := tree.GetOneNode(func(n *tree.Node[Category]) bool {
+//	    return n.ParentID == 5 && len(n.Children) == 0
+//	})
+func (t *Tree[T]) GetOneNode(matcher func(*Node[T]) bool) *Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	var view Node[T]
+	var match *Node[T]
+	t.preOrder(func(node *Node[T], _ int) bool {
+		view = *node
+		view.Children = t.children[node.ID]
+		if matcher(&view) {
+			match = node
+			return false
+		}
+		return true
+	})
+	return match
+}
+
+// GetOneWithDepth works like GetOne but also returns the depth of the matched
+// node, with roots at depth 0, e.g. for logging where a match was found.
+// Like GetOne, the first match in pre-order is returned; the depth is tracked
+// by the same pre-order walk under the read lock, so both values are
+// consistent.
+// Returns nil, 0 and false if no match is found.
+//
+// Example:
+//
+//	if node, depth, ok := tree.GetOneWithDepth(isTarget); ok {
+//	    log.Printf("matched %d at depth %d", node.ID, depth)
+//	}
+func (t *Tree[T]) GetOneWithDepth(matcher func(T) bool) (*Node[T], int, bool) {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	var match *Node[T]
+	var matchDepth int
+	t.preOrder(func(node *Node[T], depth int) bool {
+		if matcher(node.Data) {
+			match, matchDepth = node, depth
+			return false
+		}
+		return true
+	})
+	return match, matchDepth, match != nil
+}
+
+// FindFirstInOrder returns the first node matching the given condition in
+// depth-first pre-order over the sorted forest, i.e. the topmost, leftmost
+// match as FormatTreeDisplay would show it. The result is deterministic, and
+// the scan stops at the first match. GetOne behaves the same.
+// Returns nil if no match is found.
+//
+// Example:
+//
+//	item := tree.FindFirstInOrder(func(m MenuItem) bool {
+//	    return m.Enabled
+//	})
+func (t *Tree[T]) FindFirstInOrder(match func(T) bool) *Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	var found *Node[T]
+	t.preOrder(func(node *Node[T], _ int) bool {
+		if match(node.Data) {
+			found = node
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// preOrder calls visit for every node in depth-first pre-order over the
+// sorted forest, with roots at depth 0, until visit returns false.
+// It uses an explicit stack instead of recursion so that very deep trees
+// cannot exhaust the goroutine stack.
+// The caller must hold the read lock with all children lists sorted.
+func (t *Tree[T]) preOrder(visit func(node *Node[T], depth int) bool) {
+	type frame struct {
+		node  *Node[T]
+		depth int
+	}
+
+	var stack []frame
+	roots := t.children[0]
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, frame{node: roots[i]})
+	}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !visit(current.node, current.depth) {
+			return
+		}
+		// Push children in reverse so the first child is visited next
+		children := t.children[current.node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{node: children[i], depth: current.depth + 1})
+		}
+	}
+}
+
+// GetAll returns all nodes that match the given condition.
+// The result is in depth-first pre-order over the sorted forest, i.e. in the
+// order FormatTreeDisplay shows the nodes, so it is the same on every call
+// for an unchanged tree.
+// Returns an empty slice if no matches are found.
+//
+// Example:
+//
+//	nodes := tree.GetAll(func(data Category) bool {
+//	    return strings.HasPrefix(data.Name, "Child")
+//	})
+//	for _, node := range nodes {
+//	    fmt.Printf("Matched: %v\n", node.Data)
+//	}
+func (t *Tree[T]) GetAll(matcher func(T) bool) []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	nodes := make([]*Node[T], 0)
+	t.preOrder(func(node *Node[T], _ int) bool {
+		if matcher(node.Data) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// GetAllNodes works like GetAll, but the matcher receives the node instead of
+// its data, with the same view as in GetOneNode: Children holds the node's
+// sorted children during the call, while the returned nodes are the stored
+// nodes. Like GetAll, the result is in pre-order. As in GetOneNode, the
+// matcher runs under the read lock and must not call any method of the tree.
+// Returns an empty slice if no matches are found.
+//
+// Example:
+//
+//	// All leaves whose parent is node 5, in a single pass
+//	leaves := tree.GetAllNodes(func(n *tree.Node[Category]) bool {
+//	    return n.ParentID == 5 && len(n.Children) == 0
+//	})
+func (t *Tree[T]) GetAllNodes(matcher func(*Node[T]) bool) []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	nodes := make([]*Node[T], 0)
+	var view Node[T]
+	t.preOrder(func(node *Node[T], _ int) bool {
+		view = *node
+		view.Children = t.children[node.ID]
+		if matcher(&view) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// GetAllCtx works like GetAll but stops early once ctx is cancelled or its
+// deadline passes. The context is checked before the scan and then every
+// 1024 nodes, so the overhead is low.
+// Returns nil and ctx.Err() if the scan was stopped. Otherwise the result is
+// exactly that of GetAll, in pre-order.
+//
+// Example:
+//
+//	nodes, err := tree.GetAllCtx(r.Context(), func(data Category) bool {
+//	    return strings.Contains(data.Name, query)
+//	})
+func (t *Tree[T]) GetAllCtx(ctx context.Context, matcher func(T) bool) ([]*Node[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	nodes := make([]*Node[T], 0)
+	var err error
+	visited := 0
+	t.preOrder(func(node *Node[T], _ int) bool {
+		visited++
+		if visited%ctxCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		if matcher(node.Data) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// FindByPath returns the node addressed by a path of labels starting at the
+// roots, e.g. []string{"menu", "settings"}, where label computes each node's
+// path segment from its data. At each level the first child in sorted order
+// whose label matches is followed.
+// Returns false if the path is empty or doesn't resolve.
+//
+// Example:
+//
+//	node, ok := tree.FindByPath([]string{"menu", "settings"}, func(c Category) string { return c.Slug })
+func (t *Tree[T]) FindByPath(parts []string, label func(T) string) (*Node[T], bool) {
+	t.rLockSorted()
+	defer t.RUnlock()
+	return t.findByPath(parts, label)
+}
+
+// GetChildrenByPath returns the children of the node addressed by a path of
+// labels, resolved as in FindByPath. The children are returned as GetChildren
+// would, so a resolved leaf yields an empty slice and true.
+// Returns an empty slice and false if the path doesn't resolve.
+//
+// Example:
+//
+//	children, ok := tree.GetChildrenByPath([]string{"menu", "settings"}, func(c Category) string { return c.Slug })
+//	if !ok {
+//	    return fmt.Errorf("menu/settings not found")
+//	}
+func (t *Tree[T]) GetChildrenByPath(parts []string, label func(T) string) ([]*Node[T], bool) {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	node, ok := t.findByPath(parts, label)
+	if !ok {
+		return make([]*Node[T], 0), false
+	}
+	children, exists := t.children[node.ID]
+	if !exists {
+		return make([]*Node[T], 0), true
+	}
+	return children, true
+}
+
+// findByPath resolves a label path from the roots down.
+// The caller must hold the read lock with all children lists sorted.
+func (t *Tree[T]) findByPath(parts []string, label func(T) string) (*Node[T], bool) {
+	var node *Node[T]
+	parentID := 0
+	for _, part := range parts {
+		node = nil
+		for _, child := range t.children[parentID] {
+			if label(child.Data) == part {
+				node = child
+				break
+			}
+		}
+		if node == nil {
+			return nil, false
+		}
+		parentID = node.ID
+	}
+	return node, node != nil
+}
+
+// Glob returns all nodes whose label path matches the given pattern.
+// The pattern is a slash-separated list of labels starting at the roots,
+// e.g. "electronics/phones/android", where label computes each node's
+// path segment from its data.
+//
+// A "*" segment matches any single level. Recursive wildcards are not
+// supported: "**" matches only a label that is literally "**".
+// Matches are returned in the stored sibling order (pre-order among nodes
+// of the same depth). Returns an empty slice for an empty pattern.
+//
+// Example:
+//
+//	// All "android" nodes exactly two levels below "electronics"
+//	nodes := tree.Glob("electronics/*/android", func(c Category) string { return c.Slug })
+func (t *Tree[T]) Glob(pattern string, label func(T) string) []*Node[T] {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return make([]*Node[T], 0)
+	}
+	segments := strings.Split(pattern, "/")
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	candidates := t.children[0]
+	for i, segment := range segments {
+		matched := make([]*Node[T], 0)
+		for _, node := range candidates {
+			if segment == "*" || label(node.Data) == segment {
+				matched = append(matched, node)
+			}
+		}
+		if i == len(segments)-1 {
+			return matched
+		}
+
+		// Descend one level for the next segment
+		candidates = make([]*Node[T], 0)
+		for _, node := range matched {
+			candidates = append(candidates, t.children[node.ID]...)
+		}
+	}
+	return make([]*Node[T], 0)
+}
+
+// WidthByDepth returns the number of nodes at each depth across the whole forest.
+// Index d holds the number of nodes at depth d, with roots at depth 0.
+// Returns an empty slice for an empty tree.
+//
+// Example return structure for the tree Root -> (Child 1 -> Child 1.1, Child 2):
+//
+//	[1, 2, 1] // 1 root, 2 children, 1 grandchild
+func (t *Tree[T]) WidthByDepth() []int {
+	t.RLock()
+	defer t.RUnlock()
+	return t.levelWidths(t.children[0])
+}
+
+// SubtreeWidthByDepth works like WidthByDepth but is scoped to the subtree
+// rooted at rootID: index 0 holds the root itself (always 1), index 1 the
+// number of its children, and so on. It is computed in a single level-by-level pass.
+// Returns an empty slice if the root node doesn't exist.
+//
+// Example return structure for a root with 2 children and 1 grandchild:
+//
+//	[1, 2, 1]
+func (t *Tree[T]) SubtreeWidthByDepth(rootID int) []int {
+	t.RLock()
+	defer t.RUnlock()
+
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return make([]int, 0)
+	}
+	return t.levelWidths([]*Node[T]{root})
+}
+
+// levelWidths returns the number of nodes on each level, starting with level
+// and descending until a level is empty.
+// The caller must hold the read or write lock.
+func (t *Tree[T]) levelWidths(level []*Node[T]) []int {
+	widths := make([]int, 0)
+	for len(level) > 0 {
+		widths = append(widths, len(level))
+
+		next := make([]*Node[T], 0, len(level))
+		for _, node := range level {
+			next = append(next, t.children[node.ID]...)
+		}
+		level = next
+	}
+	return widths
+}
+
+// NodesInDepthRange returns all nodes across the whole forest whose depth lies
+// within [minDepth, maxDepth], with roots at depth 0.
+// Nodes are returned level by level, each level in sorted sibling order.
+// Returns an empty slice if minDepth > maxDepth or maxDepth is negative.
+//
+// Example:
+//
+//	// Get all second and third level nodes of every root
+//	nodes := tree.NodesInDepthRange(1, 2)
+func (t *Tree[T]) NodesInDepthRange(minDepth, maxDepth int) []*Node[T] {
+	if minDepth > maxDepth || maxDepth < 0 {
+		return make([]*Node[T], 0)
+	}
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make([]*Node[T], 0)
+	level := t.children[0]
+	for depth := 0; depth <= maxDepth && len(level) > 0; depth++ {
+		if depth >= minDepth {
+			result = append(result, level...)
+		}
+
+		next := make([]*Node[T], 0, len(level))
+		for _, node := range level {
+			next = append(next, t.children[node.ID]...)
+		}
+		level = next
+	}
+	return result
+}
+
+// NodesDeeperThan returns every node across the forest whose depth exceeds
+// maxDepth, with roots at depth 0, e.g. to enforce a maximum nesting policy.
+// Depths are computed in a single level-by-level pass, and nodes are returned
+// level by level, each level in sorted sibling order.
+// A negative maxDepth returns all nodes.
+//
+// Example:
+//
+//	// Nodes nested more than 5 levels below their root
+//	for _, node := range tree.NodesDeeperThan(5) {
+//	    log.Printf("node %d is too deep", node.ID)
+//	}
+func (t *Tree[T]) NodesDeeperThan(maxDepth int) []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make([]*Node[T], 0)
+	level := t.children[0]
+	for depth := 0; len(level) > 0; depth++ {
+		if depth > maxDepth {
+			result = append(result, level...)
+		}
+
+		next := make([]*Node[T], 0, len(level))
+		for _, node := range level {
+			next = append(next, t.children[node.ID]...)
+		}
+		level = next
+	}
+	return result
+}
+
+// AggregateSubtrees computes, for every node, the sum of value over the node
+// itself and all of its descendants, in a single bottom-up pass over the forest.
+// This replaces calling GetDescendants and summing for each node separately.
+//
+// Example:
+//
+//	totals := tree.AggregateSubtrees(func(p Product) float64 { return p.Price })
+//	fmt.Printf("Catalog value: %.2f\n", totals[rootID])
+func (t *Tree[T]) AggregateSubtrees(value func(T) float64) map[int]float64 {
+	t.RLock()
+	defer t.RUnlock()
+
+	// Walking the pre-order backwards completes each subtree before its parent
+	order := t.parentsFirst()
+	sums := make(map[int]float64, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		sums[node.ID] += value(node.Data)
+		if node.ParentID != 0 {
+			sums[node.ParentID] += sums[node.ID]
+		}
+	}
+	return sums
+}
+
+// AllLeafCounts returns, for every node, the number of leaves in its subtree.
+// A leaf counts as 1 for itself, so a folder's count is the number of files
+// below it at any depth. All counts are computed in a single bottom-up pass.
+//
+// Example:
+//
+//	counts := tree.AllLeafCounts()
+//	for _, folder := range tree.GetChildren(rootID) {
+//	    fmt.Printf("%v (%d files)\n", folder.Data, counts[folder.ID])
+//	}
+func (t *Tree[T]) AllLeafCounts() map[int]int {
+	t.RLock()
+	defer t.RUnlock()
+
+	order := t.parentsFirst()
+	counts := make(map[int]int, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		if len(t.children[node.ID]) == 0 {
+			counts[node.ID] = 1
+		}
+		if node.ParentID != 0 {
+			counts[node.ParentID] += counts[node.ID]
+		}
+	}
+	return counts
+}
+
+// parentsFirst returns all nodes of the forest in an order that places every
+// parent before its descendants. Sibling order is not preserved, so it suits
+// bottom-up aggregations when walked backwards.
+// The caller must hold the read or write lock.
+func (t *Tree[T]) parentsFirst() []*Node[T] {
+	order := make([]*Node[T], 0, len(t.nodes))
+	stack := append([]*Node[T](nil), t.children[0]...)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		order = append(order, node)
+		stack = append(stack, t.children[node.ID]...)
+	}
+	return order
+}
+
+// ToTree converts the flat node structure to a hierarchical nested tree structure
+// starting from the specified root ID. Returns nil if the root node doesn't exist.
+//
+// Unlike methods that return flat lists of nodes (like GetChildren or GetDescendants),
+// this method returns a self-referential nested structure where:
+//   - Each node contains direct references to its children nodes in its Children field
+//   - These children nodes in turn contain references to their own children, and so on
+//   - The returned structure is a deep copy of the original nodes to prevent modification
+//     of the internal tree structure
+//
+// This nested structure is particularly useful for:
+// - JSON serialization of the entire tree or subtree
+// - Passing to UI components that render trees
+// - Recursive processing of the tree structure
+// - Extracting a complete subtree for separate handling
+//
+// Example return structure (with concrete data) for root ID 1:
+//
+//	Node{
+//	    ID: 1,
+//	    ParentID: 0,
+//	    Data: {Title: "Root"},
+//	    Children: [
+//	        Node{
+//	            ID: 2,
+//	            ParentID: 1,
+//	            Data: {Title: "Child 1"},
+//	            Children: [
+//	                Node{ID: 4, ParentID: 2, Data: {Title: "Child 1.1"}, Children: []},
+//	                // ...more children
+//	            ]
+//	        },
+//	        Node{
+//	            ID: 3,
+//	            ParentID: 1,
+//	            Data: {Title: "Child 2"},
+//	            Children: [
+//	                // ...children
+//	            ]
+//	        }
+//	    ]
+//	}
+func (t *Tree[T]) ToTree(rootID int) *Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return nil
+	}
+
+	return t.buildTree(root)
+}
+
+// FilterTree works like ToTree but prunes the result to the nodes for which
+// keep returns true, plus the ancestors up to rootID that connect them, e.g.
+// to show search matches in context. Branches without a match are dropped
+// entirely; a kept node keeps its own matching descendants, not the others.
+// The nodes are copies in the sorted children order, so the result can be
+// modified freely.
+// Returns nil if the root doesn't exist or nothing in its subtree matches.
+//
+// Example:
+//
+//	// Show "Child 1.2.1" and the chain Root -> Child 1 -> Child 1.2 above it
+//	result := tree.FilterTree(rootID, func(c Category) bool {
+//	    return strings.Contains(c.Name, query)
+//	})
+func (t *Tree[T]) FilterTree(rootID int, keep func(T) bool) *Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return nil
+	}
+
+	// Collect the subtree parents first, then build the copies bottom-up
+	order := []*Node[T]{root}
+	for i := 0; i < len(order); i++ {
+		order = append(order, t.children[order[i].ID]...)
+	}
+
+	kept := make(map[int]*Node[T])
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		var children []*Node[T]
+		for _, child := range t.children[node.ID] {
+			if copied, ok := kept[child.ID]; ok {
+				children = append(children, copied)
+			}
+		}
+		if len(children) > 0 || keep(node.Data) {
+			kept[node.ID] = &Node[T]{
+				ID:       node.ID,
+				ParentID: node.ParentID,
+				Data:     node.Data,
+				Children: children,
+			}
+		}
+	}
+	return kept[rootID]
+}
+
+// GetForest returns every root of the tree as a nested structure, each built
+// as by ToTree, for trees with several top-level nodes. The roots follow the
+// sorted sibling order, as in GetRoots.
+// Returns an empty slice for an empty tree.
+//
+// Example:
+//
+//	for _, root := range tree.GetForest() {
+//	    renderTree(root)
+//	}
+func (t *Tree[T]) GetForest() []*Node[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	roots := make([]*Node[T], len(t.children[0]))
+	for i, root := range t.children[0] {
+		roots[i] = t.buildTree(root)
+	}
+	return roots
+}
+
+// MarshalJSON encodes the whole forest as a JSON array of nested root nodes,
+// as returned by GetForest, so json.Marshal(tree) sends the complete tree.
+// Roots and children follow the sorted sibling order. An empty tree encodes
+// as an empty array.
+//
+// Example:
+//
+//	data, err := json.Marshal(tree)
+//	// [{"id":1,"parent_id":0,"data":{...},"children":[...]}, ...]
+func (t *Tree[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.GetForest())
+}
+
+// ToJSONIndent returns the nested subtree rooted at rootID, as built by ToTree,
+// encoded as indented JSON for golden-file comparisons.
+// The output is deterministic: children follow the stored sibling order,
+// struct fields follow their declaration order and map keys are sorted by
+// encoding/json. prefix and indent work as in json.MarshalIndent.
+// Returns an error if the root node doesn't exist or the data can't be encoded.
+//
+// Example:
+//
+//	got, err := tree.ToJSONIndent(1, "", "  ")
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	want, _ := os.ReadFile("testdata/tree.golden.json")
+//	if !bytes.Equal(got, want) {
+//	    t.Errorf("tree JSON mismatch")
+//	}
+func (t *Tree[T]) ToJSONIndent(rootID int, prefix, indent string) ([]byte, error) {
+	root := t.ToTree(rootID)
+	if root == nil {
+		return nil, nodeErrorf(rootID, ErrNodeNotFound, "root node %d not found", rootID)
+	}
+	return json.MarshalIndent(root, prefix, indent)
+}
+
+// mermaidEscaper replaces the characters that would end or break a quoted
+// Mermaid label with their entity codes. "#" goes first as it starts a code.
+var mermaidEscaper = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"\r\n", " ",
+	"\n", " ",
+)
+
+// ToMermaid renders the subtree rooted at rootID as a Mermaid flowchart, e.g.
+// to paste a category hierarchy into Markdown documentation.
+// The output is a "graph TD" block that declares the root, followed by one
+// edge per parent-child relationship in depth-first order with children in
+// sorted order. Nodes are named n<ID> and labeled with the text returned by
+// label, with quotes and other special characters escaped.
+// Returns an error if the root node doesn't exist.
+//
+// Example output for the tree Root -> (Child 1 -> Child 1.1, Child 2):
+//
+//	graph TD
+//	    n1["Root"]
+//	    n1 --> n2["Child 1"]
+//	    n2 --> n4["Child 1.1"]
+//	    n1 --> n3["Child 2"]
+func (t *Tree[T]) ToMermaid(rootID int, label func(T) string) (string, error) {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return "", nodeErrorf(rootID, ErrNodeNotFound, "root node %d not found", rootID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	fmt.Fprintf(&sb, "    n%d[\"%s\"]\n", root.ID, mermaidEscaper.Replace(label(root.Data)))
+
+	// Push in reverse so the first child is visited first
+	stack := slices.Clone(t.children[rootID])
+	slices.Reverse(stack)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		fmt.Fprintf(&sb, "    n%d --> n%d[\"%s\"]\n", node.ParentID, node.ID, mermaidEscaper.Replace(label(node.Data)))
+
+		children := t.children[node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// DOTOption configures the Graphviz output of ToDOTWithOptions.
+type DOTOption struct {
+	LeftToRight bool // Lay out the graph left to right (rankdir=LR) instead of top down
+	ShowID      bool // Prefix each label with the node ID, e.g. "2: Child 1"
+}
+
+// dotEscaper escapes the characters that are special inside a quoted DOT
+// string. Newlines become "\n" so they still render as line breaks.
+var dotEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// ToDOT renders the subtree rooted at rootID as a Graphviz digraph laid out
+// top down, ready to be piped into "dot -Tpng".
+// It is equivalent to ToDOTWithOptions with a zero DOTOption.
+// Returns an error if the root node doesn't exist.
+func (t *Tree[T]) ToDOT(rootID int, label func(T) string) (string, error) {
+	return t.ToDOTWithOptions(rootID, label, DOTOption{})
+}
+
+// ToDOTWithOptions renders the subtree rooted at rootID as a Graphviz digraph.
+// Nodes are declared by ID with the quoted, escaped text returned by label,
+// each followed by its "parent -> child;" edge, in depth-first order with
+// children in sorted order.
+// Returns an error if the root node doesn't exist.
 //
-//	[
-//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},     // Parent
-//	    {ID: 1, ParentID: 0, Data: Category{Name: "Child 2"}}      // Grandparent
-//	]
-func (t *Tree[T]) GetAncestors(id int, includeSelf bool) []*Node[T] {
-	t.RLock()
+// Example output for the tree Root -> (Child 1, Child 2) with ShowID set:
+//
+//	digraph {
+//	    rankdir=TB;
+//	    1 [label="1: Root"];
+//	    2 [label="2: Child 1"];
+//	    1 -> 2;
+//	    3 [label="3: Child 2"];
+//	    1 -> 3;
+//	}
+func (t *Tree[T]) ToDOTWithOptions(rootID int, label func(T) string, opt DOTOption) (string, error) {
+	t.rLockSorted()
 	defer t.RUnlock()
 
-	ancestors := make([]*Node[T], 0)
-	if includeSelf {
-		if node, exists := t.nodes[id]; exists {
-			ancestors = append(ancestors, node)
+	root, exists := t.nodes[rootID]
+	if !exists {
+		return "", nodeErrorf(rootID, ErrNodeNotFound, "root node %d not found", rootID)
+	}
+
+	rankdir := "TB"
+	if opt.LeftToRight {
+		rankdir = "LR"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph {\n")
+	fmt.Fprintf(&sb, "    rankdir=%s;\n", rankdir)
+
+	stack := []*Node[T]{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		text := label(node.Data)
+		if opt.ShowID {
+			text = fmt.Sprintf("%d: %s", node.ID, text)
+		}
+		fmt.Fprintf(&sb, "    %d [label=\"%s\"];\n", node.ID, dotEscaper.Replace(text))
+		if node.ID != rootID {
+			fmt.Fprintf(&sb, "    %d -> %d;\n", node.ParentID, node.ID)
+		}
+
+		// Push in reverse so the first child is visited first
+		children := t.children[node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
 		}
 	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
 
-	currentID := id
-	for {
-		node, exists := t.nodes[currentID]
-		if !exists || node.ParentID == 0 {
-			break
+// buildTree builds the nested tree structure below the given node.
+// Creates a deep copy of the node and its children to avoid
+// modifying the original data structure.
+// It uses an explicit stack instead of recursion so that very deep trees
+// cannot exhaust the goroutine stack.
+func (t *Tree[T]) buildTree(node *Node[T]) *Node[T] {
+	if len(t.children[node.ID]) == 0 {
+		return node
+	}
+
+	// Create a new node to avoid modifying the original
+	copyNode := func(n *Node[T]) *Node[T] {
+		return &Node[T]{
+			ID:       n.ID,
+			ParentID: n.ParentID,
+			Data:     n.Data,
+			Children: make([]*Node[T], len(t.children[n.ID])),
 		}
-		if parent, exists := t.nodes[node.ParentID]; exists {
-			ancestors = append(ancestors, parent)
-			currentID = parent.ID
-		} else {
-			break
+	}
+
+	root := copyNode(node)
+	stack := []*Node[T]{root}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for i, child := range t.children[current.ID] {
+			if len(t.children[child.ID]) == 0 {
+				current.Children[i] = child
+				continue
+			}
+			newChild := copyNode(child)
+			current.Children[i] = newChild
+			stack = append(stack, newChild)
 		}
 	}
 
-	return ancestors
+	return root
 }
 
-// GetAncestorIDs returns all ancestor IDs of the specified node.
-// If includeSelf is true, the node's own ID will be included as the first element.
-// Returns IDs ordered from the node itself (if included) up to the root.
+// ToCustom folds a nested node structure (as returned by ToTree) into a
+// caller-defined recursive type. The build function is called bottom-up:
+// it receives a node's data together with the already converted children
+// and returns the converted node. Children are passed in their stored order.
+// Returns the zero value of R if root is nil.
 //
-// Example return structure for node ID 4 (Child 1.1):
+// This decouples the serialization shape from Node, e.g. to use a
+// different field name for the children:
 //
-//	[2, 1] // 2 is the parent ID of 4, 1 is the grandparent ID of 4
-func (t *Tree[T]) GetAncestorIDs(id int, includeSelf bool) []int {
-	ancestors := t.GetAncestors(id, includeSelf)
-	ancestorIDs := make([]int, len(ancestors))
-	for i, ancestor := range ancestors {
-		ancestorIDs[i] = ancestor.ID
+//	type MenuItem struct {
+//	    Name  string     `json:"name"`
+//	    Nodes []MenuItem `json:"nodes"`
+//	}
+//
+//	menu := tree.ToCustom(t.ToTree(1), func(c Category, nodes []MenuItem) MenuItem {
+//	    return MenuItem{Name: c.Name, Nodes: nodes}
+//	})
+func ToCustom[T, R any](root *Node[T], build func(data T, children []R) R) R {
+	if root == nil {
+		var zero R
+		return zero
 	}
-	return ancestorIDs
+
+	var children []R
+	if len(root.Children) > 0 {
+		children = make([]R, len(root.Children))
+		for i, child := range root.Children {
+			children[i] = ToCustom(child, build)
+		}
+	}
+	return build(root.Data, children)
 }
 
-// GetNodePath returns the path of node IDs from the root to the specified node.
-// Returns IDs ordered from the root down to the node.
+// MapTree returns a new tree with the same structure as t (IDs, parent IDs
+// and sibling order) whose node data is transformed by fn.
+// All traversal methods remain available on the projected tree, which makes
+// it easy to strip internal fields before serialization.
+// The children order is copied as is, nothing is re-sorted. Metadata is not copied.
 //
 // Example:
 //
-//	path := tree.GetNodePath(nodeID, true)
-//	fmt.Printf("Node path: %v\n", path)
-//
-// Example return structure for node ID 4 (Child 1.1):
+//	type CategoryDTO struct {
+//	    Name string `json:"name"`
+//	}
 //
-//	[1, 2, 4] // 1 is the root, 2 is the parent of 4
-func (t *Tree[T]) GetNodePath(id int, includeSelf bool) []int {
-	ancestors := t.GetAncestors(id, includeSelf)
-	ancestorIDs := make([]int, len(ancestors))
-	for i := len(ancestors) - 1; i >= 0; i-- {
-		ancestorIDs[len(ancestors)-1-i] = ancestors[i].ID
+//	dto := tree.MapTree(categories, func(c Category) CategoryDTO {
+//	    return CategoryDTO{Name: c.Name}
+//	})
+//	data, err := json.Marshal(dto.ToTree(1))
+func MapTree[T, R any](t *Tree[T], fn func(T) R) *Tree[R] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	mapped := New[R]()
+	for id, node := range t.nodes {
+		mapped.nodes[id] = &Node[R]{
+			ID:       node.ID,
+			ParentID: node.ParentID,
+			Data:     fn(node.Data),
+		}
 	}
-	return ancestorIDs
+	for parentID, children := range t.children {
+		mappedChildren := make([]*Node[R], len(children))
+		for i, child := range children {
+			mappedChildren[i] = mapped.nodes[child.ID]
+		}
+		mapped.children[parentID] = mappedChildren
+	}
+	return mapped
 }
 
-// GetAncestorIDAtDepth returns the ancestor ID of the specified node at a given depth.
-// Parameters:
-//   - id: The node ID whose ancestor to find
-//   - depth: How many levels up to traverse
-//   - fromRoot: If true, counts depth from root down; if false, counts from node up
-//
-// Returns 0 if:
-//   - The node doesn't exist
-//   - The depth is invalid
-//   - No ancestor exists at the specified depth
-//
-// Example:
+// EnrichedNode is a flat, denormalized representation of a node.
+// It carries the node's depth and its root-to-node path alongside the data,
+// which is convenient for exporting the tree to tabular storage.
+type EnrichedNode[T any] struct {
+	ID       int   `json:"id"`        // Unique identifier for the node
+	ParentID int   `json:"parent_id"` // ID of the parent node (0 for root)
+	Depth    int   `json:"depth"`     // Depth of the node (0 for root)
+	Path     []int `json:"path"`      // IDs from the root down to the node itself
+	Data     T     `json:"data"`      // Arbitrary data associated with the node
+}
+
+// ExportEnriched returns every node of the forest as an EnrichedNode.
+// Depth and path are computed in a single depth-first pass starting from the roots,
+// so the result follows the same order as the sorted children lists.
 //
-//	// Get parent's parent (depth=2, counting up from node)
-//	grandparentID := tree.GetAncestorIDAtDepth(nodeID, 2, false)
+// Example return structure:
 //
-//	// Get second level node (depth=2, counting down from root)
-//	secondLevelID := tree.GetAncestorIDAtDepth(nodeID, 2, true)
-func (t *Tree[T]) GetAncestorIDAtDepth(id int, depth int, fromRoot bool) int {
-	parentIDs := t.GetAncestorIDs(id, false)
-	if depth > len(parentIDs) || depth <= 0 || len(parentIDs) == 0 {
-		return 0
+//	[
+//	    {ID: 1, ParentID: 0, Depth: 0, Path: [1], Data: Category{Name: "Root"}},
+//	    {ID: 2, ParentID: 1, Depth: 1, Path: [1, 2], Data: Category{Name: "Child 1"}},
+//	    {ID: 4, ParentID: 2, Depth: 2, Path: [1, 2, 4], Data: Category{Name: "Child 1.1"}},
+//	    {ID: 3, ParentID: 1, Depth: 1, Path: [1, 3], Data: Category{Name: "Child 2"}}
+//	]
+func (t *Tree[T]) ExportEnriched() []EnrichedNode[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make([]EnrichedNode[T], 0, len(t.nodes))
+	t.exportEnriched(&result)
+	return result
+}
+
+// exportEnriched appends every node of the forest to result in depth-first
+// order, together with its depth and path.
+// It uses an explicit stack instead of recursion so that very deep trees
+// cannot exhaust the goroutine stack.
+func (t *Tree[T]) exportEnriched(result *[]EnrichedNode[T]) {
+	type frame struct {
+		node       *Node[T]
+		parentPath []int // Path of the node's parent, shared with its siblings
 	}
-	if fromRoot {
-		return parentIDs[depth-1]
+
+	// Push in reverse so the first child is visited first
+	var stack []frame
+	roots := t.children[0]
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, frame{node: roots[i]})
+	}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Each node gets its own copy of the path
+		path := make([]int, len(current.parentPath)+1)
+		copy(path, current.parentPath)
+		path[len(current.parentPath)] = current.node.ID
+
+		*result = append(*result, EnrichedNode[T]{
+			ID:       current.node.ID,
+			ParentID: current.node.ParentID,
+			Depth:    len(current.parentPath),
+			Path:     path,
+			Data:     current.node.Data,
+		})
+
+		children := t.children[current.node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{node: children[i], parentPath: path})
+		}
 	}
-	return parentIDs[len(parentIDs)-depth]
 }
 
-// GetDescendants returns all descendant nodes of the specified node up to maxDepth.
-// The nodes are returned in depth-first order.
+// Edges returns the parent-to-child edges of the forest as [parentID, childID]
+// pairs in depth-first pre-order, the same order as ExportEnriched.
+// Root nodes have no parent and therefore produce no edge.
 //
-// Parameters:
-//   - id: The node ID whose descendants to retrieve
-//   - maxDepth: Maximum depth to traverse (0 for unlimited, negative for none)
+// Example return structure:
+//
+//	[[1, 2], [2, 4], [2, 5], [1, 3], [3, 6]]
+func (t *Tree[T]) Edges() [][2]int {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	edges := make([][2]int, 0, len(t.nodes))
+	stack := slices.Clone(t.children[0])
+	slices.Reverse(stack)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if node.ParentID != 0 {
+			edges = append(edges, [2]int{node.ParentID, node.ID})
+		}
+		// Push children in reverse so the first child is visited next
+		children := t.children[node.ID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
+	}
+	return edges
+}
+
+// Fingerprint returns a deterministic 64-bit hash of the whole forest, e.g. to
+// key a render cache and skip work when the tree hasn't changed.
+// It folds in every node's ID, parent ID, position in the sorted sibling order
+// and the bytes returned by hashData, so loading the same structure and data
+// yields the same value regardless of the input order.
+// The hash is FNV-1a, which is fast but not cryptographically secure.
 //
 // Example:
 //
-//	// Get all descendants up to 2 levels deep
-//	descendants := tree.GetDescendants(nodeID, 2)
-//	for _, desc := range descendants {
-//	    fmt.Printf("Descendant: %v\n", desc.Data)
+//	key := tree.Fingerprint(func(c Category) []byte { return []byte(c.Name) })
+//	if html, ok := cache[key]; ok {
+//	    return html
 //	}
-//
-// Example return structure for node ID 1 with maxDepth 3:
-//
-//	[
-//	    {ID: 2, ParentID: 1, Data: Category{Name: "Child 1"}},     // Level 1
-//	    {ID: 3, ParentID: 1, Data: Category{Name: "Child 2"}},     // Level 1
-//	    {ID: 4, ParentID: 2, Data: Category{Name: "Child 1.1"}},   // Level 2
-//	    {ID: 5, ParentID: 2, Data: Category{Name: "Child 1.2"}},   // Level 2
-//	    {ID: 7, ParentID: 5, Data: Category{Name: "Child 1.2.1"}}, // Level 3
-//	    {ID: 8, ParentID: 5, Data: Category{Name: "Child 1.2.2"}}, // Level 3
-//	    {ID: 6, ParentID: 3, Data: Category{Name: "Child 2.1"}}    // Level 2
-//	]
-func (t *Tree[T]) GetDescendants(id int, maxDepth int) []*Node[T] {
-	if maxDepth < 0 {
-		return nil
+func (t *Tree[T]) Fingerprint(hashData func(T) []byte) uint64 {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	h := fnv.New64a()
+	buf := make([]byte, 0, 32)
+
+	// Pre-order with child counts encodes the structure unambiguously
+	stack := slices.Clone(t.children[0])
+	slices.Reverse(stack)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(stack)))
+	h.Write(buf)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		children := t.children[node.ID]
+		data := hashData(node.Data)
+		buf = buf[:0]
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(node.ID))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(node.ParentID))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(children)))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(data)))
+		h.Write(buf)
+		h.Write(data)
+
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
 	}
+	return h.Sum64()
+}
 
+// CanMove reports whether the specified node could be moved under newParentID,
+// without changing the tree. A newParentID of 0 means moving the node to the root level.
+// Returns nil if the move is allowed, or the error describing why it isn't:
+//   - The node doesn't exist
+//   - The new parent doesn't exist
+//   - The new parent is the node itself or one of its descendants
+//
+// Example:
+//
+//	if err := tree.CanMove(dragID, dropID); err != nil {
+//	    showNotAllowedCursor(err)
+//	}
+func (t *Tree[T]) CanMove(id, newParentID int) error {
 	t.RLock()
 	defer t.RUnlock()
-	return t.getDescendantsRecursive(id, 0, maxDepth)
+	return t.validateMove(id, newParentID)
 }
 
-// getDescendantsRecursive is an internal helper function that recursively
-// builds the list of descendants for a given node.
-func (t *Tree[T]) getDescendantsRecursive(id, currentDepth, maxDepth int) []*Node[T] {
-	if maxDepth > 0 && currentDepth >= maxDepth {
-		return nil
-	}
+// AddNode inserts a single item into a loaded tree without rebuilding it.
+// The ID and parent ID are extracted with the functions from the last Load,
+// and the item is placed among its siblings with the stored sort function.
+// Only the new node's sibling list is re-sorted; with WithLazySort a list that
+// is not sorted yet stays pending until it is read. If the siblings were
+// ordered by MoveBefore or MoveAfter, the node is appended after them instead,
+// so the manual order is kept.
+//
+// Returns an error if:
+//   - The tree was not loaded with WithIDFunc and WithParentIDFunc
+//   - The ID is not positive or already exists
+//   - The parent ID is not 0 and the parent doesn't exist
+//
+// Example:
+//
+//	if err := tree.AddNode(Category{ID: 42, ParentID: 1, Name: "New"}); err != nil {
+//	    return err
+//	}
+func (t *Tree[T]) AddNode(item T) error {
+	t.Lock()
+	defer t.Unlock()
+	t.invalidateDisplay()
 
-	children := t.children[id]
-	if len(children) == 0 {
-		return nil
+	if err := t.checkIDFuncs(); err != nil {
+		return err
+	}
+	id, parentID := t.idFunc(item), t.parentIDFunc(item)
+	if id <= 0 {
+		return nodeErrorf(id, ErrInvalidID, "node %d: ID must be positive", id)
+	}
+	if _, exists := t.nodes[id]; exists {
+		return nodeErrorf(id, ErrDuplicateID, "duplicate node ID: %d", id)
+	}
+	if id == parentID {
+		return &NodeError{ID: id, Err: ErrSelfParent}
+	}
+	if _, exists := t.nodes[parentID]; !exists && parentID != 0 {
+		return nodeErrorf(id, ErrInvalidParent, "parent node %d not found", parentID)
 	}
 
-	// Pre-allocate slice with estimated capacity
-	descendants := make([]*Node[T], 0, len(children)*2)
-	descendants = append(descendants, children...)
-
-	// Recursively get descendants for each child
-	for _, child := range children {
-		childDescendants := t.getDescendantsRecursive(child.ID, currentDepth+1, maxDepth)
-		if len(childDescendants) > 0 {
-			descendants = append(descendants, childDescendants...)
-		}
+	node := &Node[T]{
+		ID:       id,
+		ParentID: parentID,
+		Data:     item,
 	}
+	if len(t.intern) > 0 {
+		internStrings(&node.Data, t.intern)
+	}
+	t.nodes[id] = node
 
-	return descendants
+	// Build a new list, the old one may have been handed out by GetChildren
+	t.children[parentID] = append(slices.Clone(t.children[parentID]), node)
+	if !t.unsorted[parentID] && !t.manual[parentID] {
+		t.sortChildren(parentID)
+	}
+	return nil
 }
 
-// GetDescendantsIDs returns all descendant IDs of the specified node.
-// Parameters follow the same rules as GetDescendants.
+// UpdateNodeData replaces the data of the specified node, e.g. after a
+// rename, and re-sorts its siblings with the stored sort function in case the
+// sort key changed. Siblings ordered by MoveBefore or MoveAfter are not
+// re-sorted, so the node keeps its manual position. The ID and parent ID of the new data, extracted with the
+// functions from the last Load, must match the node, as they define its
+// position in the tree; use MoveBefore or MoveAfter to move a node.
+// Nodes obtained before the call keep the old data, as the node is replaced
+// with a new node value.
+//
+// Returns an error if the node doesn't exist, if the tree was not loaded with
+// WithIDFunc and WithParentIDFunc, or if the new data has a different ID or
+// parent ID.
 //
 // Example:
 //
-//	// Get IDs of all descendants up to 2 levels deep
-//	descendantIDs := tree.GetDescendantsIDs(nodeID, 2)
-//	fmt.Printf("Descendant IDs: %v\n", descendantIDs)
-func (t *Tree[T]) GetDescendantsIDs(id int, maxDepth int) []int {
-	descendants := t.GetDescendants(id, maxDepth)
-	if descendants == nil {
-		return nil
+//	category.Name = "Renamed"
+//	if err := tree.UpdateNodeData(category.ID, category); err != nil {
+//	    return err
+//	}
+func (t *Tree[T]) UpdateNodeData(id int, data T) error {
+	t.Lock()
+	defer t.Unlock()
+	t.invalidateDisplay()
+
+	node, exists := t.nodes[id]
+	if !exists {
+		return nodeErrorf(id, ErrNodeNotFound, "node %d not found", id)
+	}
+	if err := t.checkIDFuncs(); err != nil {
+		return err
+	}
+	if dataID := t.idFunc(data); dataID != id {
+		return nodeErrorf(id, ErrInvalidID, "node %d: data has ID %d", id, dataID)
+	}
+	if parentID := t.parentIDFunc(data); parentID != node.ParentID {
+		return nodeErrorf(id, ErrInvalidParent, "node %d: data has parent ID %d, want %d", id, parentID, node.ParentID)
 	}
 
-	ids := make([]int, len(descendants))
-	for i, descendant := range descendants {
-		ids[i] = descendant.ID
+	updated := &Node[T]{ID: id, ParentID: node.ParentID, Data: data}
+	if len(t.intern) > 0 {
+		internStrings(&updated.Data, t.intern)
 	}
-	return ids
+	t.nodes[id] = updated
+
+	// Build a new list, slices returned by GetChildren must not change
+	siblings := slices.Clone(t.children[node.ParentID])
+	siblings[slices.Index(siblings, node)] = updated
+	t.children[node.ParentID] = siblings
+	if !t.unsorted[node.ParentID] && !t.manual[node.ParentID] {
+		t.sortChildren(node.ParentID)
+	}
+	return nil
 }
 
-// GetSiblings returns all sibling nodes of the specified node.
-// If includeSelf is true, the node itself will be included in the result.
-// Returns nil if the node doesn't exist.
+// checkIDFuncs returns an error if the tree has no ID functions to extract
+// the IDs of new data, e.g. after LoadFromNested without them.
+func (t *Tree[T]) checkIDFuncs() error {
+	if t.idFunc == nil || t.parentIDFunc == nil {
+		return fmt.Errorf("id functions are not set, load the tree with WithIDFunc and WithParentIDFunc first")
+	}
+	return nil
+}
+
+// MoveBefore moves the specified node next to targetID, immediately before it
+// in the sibling order, reparenting it under the target's parent if needed.
+// This matches drag-and-drop "insert before" semantics. The position is set
+// manually and bypasses the sort function; AddNode and UpdateNodeData keep it,
+// while RemoveNode with RemoveReparent into the same list and the next Load
+// re-sort the siblings.
+// Nodes obtained before the call keep their old ParentID, as the moved node is
+// replaced with a new node value.
+//
+// Returns an error if either node doesn't exist, if id equals targetID, or if
+// the move would place the node under itself or one of its descendants.
 //
 // Example:
 //
-//	// Get all siblings excluding self
-//	siblings := tree.GetSiblings(nodeID, false)
-//	for _, sibling := range siblings {
-//	    fmt.Printf("Sibling: %v\n", sibling.Data)
+//	if err := tree.MoveBefore(dragID, dropTargetID); err != nil {
+//	    return err
 //	}
-func (t *Tree[T]) GetSiblings(id int, includeSelf bool) []*Node[T] {
+func (t *Tree[T]) MoveBefore(id, targetID int) error {
+	return t.moveNextTo(id, targetID, false)
+}
+
+// MoveAfter works like MoveBefore but places the node immediately after targetID.
+func (t *Tree[T]) MoveAfter(id, targetID int) error {
+	return t.moveNextTo(id, targetID, true)
+}
+
+// ReorderValues computes new sort values from the current sibling order, e.g.
+// to persist a manual ordering made with MoveBefore and MoveAfter.
+// For every sibling group, including the roots, assign is called with each
+// node's data and its zero-based index among its siblings, and the returned
+// data is collected by node ID. The tree itself is not modified.
+//
+// Example:
+//
+//	tree.MoveBefore(draggedID, targetID)
+//	for id, item := range tree.ReorderValues(func(c Category, i int) Category {
+//	    c.Sort = i
+//	    return c
+//	}) {
+//	    db.UpdateSort(id, item.Sort)
+//	}
+func (t *Tree[T]) ReorderValues(assign func(data T, index int) T) map[int]T {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	result := make(map[int]T, len(t.nodes))
+	for _, children := range t.children {
+		for i, child := range children {
+			result[child.ID] = assign(child.Data, i)
+		}
+	}
+	return result
+}
+
+// moveNextTo moves id next to targetID in the target's children list,
+// before it or after it.
+func (t *Tree[T]) moveNextTo(id, targetID int, after bool) error {
 	t.Lock()
 	defer t.Unlock()
+	t.invalidateDisplay()
 
-	node, exists := t.nodes[id]
+	target, exists := t.nodes[targetID]
 	if !exists {
-		return nil
+		return nodeErrorf(targetID, ErrNodeNotFound, "target node %d not found", targetID)
+	}
+	if id == targetID {
+		return fmt.Errorf("cannot move node %d next to itself", id)
+	}
+	if err := t.validateMove(id, target.ParentID); err != nil {
+		return err
 	}
 
-	siblings := t.children[node.ParentID]
-	if !includeSelf {
-		// Filter out self from siblings
-		filtered := make([]*Node[T], 0, len(siblings)-1)
-		for _, sibling := range siblings {
-			if sibling.ID != id {
-				filtered = append(filtered, sibling)
-			}
-		}
-		return filtered
+	// Sort pending lists first so a later lazy sort can't undo the position
+	node := t.nodes[id]
+	if t.unsorted[target.ParentID] {
+		t.sortChildren(target.ParentID)
 	}
+	t.detachChild(node)
 
-	return siblings
+	// Build a new list, slices returned by GetChildren must not change
+	moved := &Node[T]{ID: node.ID, ParentID: target.ParentID, Data: node.Data}
+	siblings := t.children[target.ParentID]
+	index := slices.Index(siblings, target)
+	if after {
+		index++
+	}
+	t.children[target.ParentID] = slices.Concat(siblings[:index], []*Node[T]{moved}, siblings[index:])
+	t.nodes[id] = moved
+	if t.manual == nil {
+		t.manual = make(map[int]bool)
+	}
+	t.manual[target.ParentID] = true
+	return nil
 }
 
-// GetSiblingsIDs returns all sibling IDs of the specified node.
-// If includeSelf is true, the node's own ID will be included in the result.
-// Returns nil if the node doesn't exist.
-func (t *Tree[T]) GetSiblingsIDs(id int, includeSelf bool) []int {
-	siblings := t.GetSiblings(id, includeSelf)
+// detachChild removes the node from its parent's children list,
+// dropping the list once it becomes empty. The list is rebuilt rather than
+// modified in place, so slices previously returned to callers don't change.
+// The caller must hold the write lock.
+func (t *Tree[T]) detachChild(node *Node[T]) {
+	siblings := make([]*Node[T], 0, len(t.children[node.ParentID]))
+	for _, sibling := range t.children[node.ParentID] {
+		if sibling.ID != node.ID {
+			siblings = append(siblings, sibling)
+		}
+	}
 	if len(siblings) == 0 {
+		delete(t.children, node.ParentID)
+		delete(t.unsorted, node.ParentID)
+		delete(t.manual, node.ParentID)
+		return
+	}
+	t.children[node.ParentID] = siblings
+}
+
+// validateMove checks whether the node can be moved under newParentID.
+// All move operations share these rules.
+// The caller must hold the read or write lock.
+func (t *Tree[T]) validateMove(id, newParentID int) error {
+	if _, exists := t.nodes[id]; !exists {
+		return nodeErrorf(id, ErrNodeNotFound, "node %d not found", id)
+	}
+	if newParentID == 0 {
 		return nil
 	}
+	if _, exists := t.nodes[newParentID]; !exists {
+		return nodeErrorf(newParentID, ErrNodeNotFound, "parent node %d not found", newParentID)
+	}
 
-	ids := make([]int, len(siblings))
-	for i, sibling := range siblings {
-		ids[i] = sibling.ID
+	// Walk up from the new parent to make sure the node is not among its ancestors
+	for currentID := newParentID; currentID != 0; currentID = t.nodes[currentID].ParentID {
+		if currentID == id {
+			if newParentID == id {
+				return nodeErrorf(id, ErrCircularReference, "cannot move node %d under itself", id)
+			}
+			return nodeErrorf(id, ErrCircularReference, "cannot move node %d under its descendant %d", id, newParentID)
+		}
 	}
-	return ids
+	return nil
 }
 
-// GetOne returns the first node that matches the given condition.
-// Returns nil if no match is found.
+// Reindex renumbers all nodes with contiguous IDs from 1 to N in depth-first
+// order, so every parent gets a smaller ID than its children.
+// The structure, the sibling order and any metadata are preserved.
+// Returns the mapping from old to new IDs, which can be used to update
+// references held outside the tree.
+//
+// If the node data carries its IDs, pass relabel to rewrite them: it is
+// called with each node's data and its new ID and parent ID, and must return
+// data that the ID functions of the last Load map to those IDs. Otherwise
+// later calls such as UpdateNodeData, which check the data against the node,
+// fail with the old IDs. With a nil relabel the data is left untouched.
+// relabel must not call any method of the tree, as the write lock is held
+// while it runs.
+// Nodes obtained before the call keep their old IDs, as Reindex builds new
+// node values.
 //
 // Example:
 //
-//	node := tree.GetOne(func(data Category) bool {
-//	    return data.Name == "Target"
+//	mapping := tree.Reindex(func(c Category, id, parentID int) Category {
+//	    c.ID, c.ParentID = id, parentID
+//	    return c
 //	})
-//	if node != nil {
-//	    fmt.Printf("Found: %v\n", node.Data)
+//	for oldID, newID := range mapping {
+//	    db.UpdateReference(oldID, newID)
 //	}
-func (t *Tree[T]) GetOne(matcher func(T) bool) *Node[T] {
-	t.RLock()
-	defer t.RUnlock()
+func (t *Tree[T]) Reindex(relabel func(data T, newID, newParentID int) T) map[int]int {
+	t.Lock()
+	defer t.Unlock()
+	t.invalidateDisplay()
+	t.sortPending()
 
-	for _, node := range t.nodes {
-		if matcher(node.Data) {
-			return node
+	mapping := make(map[int]int, len(t.nodes))
+	nodes := make(map[int]*Node[T], len(t.nodes))
+	children := make(map[int][]*Node[T], len(t.children))
+
+	// Walk the forest depth-first, parents are numbered before their children
+	stack := make([]*Node[T], 0, len(t.children[0]))
+	for i := len(t.children[0]) - 1; i >= 0; i-- {
+		stack = append(stack, t.children[0][i])
+	}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		newID := len(mapping) + 1
+		mapping[node.ID] = newID
+
+		// Parents are always renumbered first, roots keep ParentID 0
+		newNode := &Node[T]{
+			ID:       newID,
+			ParentID: mapping[node.ParentID],
+			Data:     node.Data,
+		}
+		if relabel != nil {
+			newNode.Data = relabel(node.Data, newID, newNode.ParentID)
+		}
+		nodes[newID] = newNode
+		children[newNode.ParentID] = append(children[newNode.ParentID], newNode)
+
+		nodeChildren := t.children[node.ID]
+		for i := len(nodeChildren) - 1; i >= 0; i-- {
+			stack = append(stack, nodeChildren[i])
 		}
 	}
-	return nil
+
+	meta := make(map[int]map[string]any, len(t.meta))
+	for oldID, values := range t.meta {
+		meta[mapping[oldID]] = values
+	}
+	manual := make(map[int]bool, len(t.manual))
+	for parentID := range t.manual {
+		manual[mapping[parentID]] = true
+	}
+
+	t.nodes = nodes
+	t.children = children
+	t.meta = meta
+	t.manual = manual
+	return mapping
 }
 
-// GetAll returns all nodes that match the given condition.
-// Returns nil if no matches are found.
+// Clear removes all nodes and metadata from the tree so the instance can be
+// reused without allocating a new one. The internal maps are emptied in place
+// and keep their capacity.
+// The configuration stored by the last Load, such as the sort function, is
+// retained and applies to nodes added afterwards, while LastLoadReport and
+// LastLoadStats are reset as the loaded nodes are gone.
 //
 // Example:
 //
-//	nodes := tree.GetAll(func(data Category) bool {
-//	    return strings.HasPrefix(data.Name, "Child")
-//	})
-//	for _, node := range nodes {
-//	    fmt.Printf("Matched: %v\n", node.Data)
+//	for _, batch := range batches {
+//	    tree.Clear()
+//	    process(tree, batch)
 //	}
-func (t *Tree[T]) GetAll(matcher func(T) bool) []*Node[T] {
-	t.RLock()
-	defer t.RUnlock()
+func (t *Tree[T]) Clear() {
+	t.Lock()
+	defer t.Unlock()
+	t.invalidateDisplay()
 
-	nodes := make([]*Node[T], 0)
-	for _, node := range t.nodes {
-		if matcher(node.Data) {
-			nodes = append(nodes, node)
-		}
-	}
-	return nodes
+	clear(t.nodes)
+	clear(t.children)
+	clear(t.meta)
+	clear(t.unsorted)
+	clear(t.manual)
+	t.report = LoadReport{}
+	t.stats = LoadStats{}
 }
 
-// ToTree converts the flat node structure to a hierarchical nested tree structure
-// starting from the specified root ID. Returns nil if the root node doesn't exist.
-//
-// Unlike methods that return flat lists of nodes (like GetChildren or GetDescendants),
-// this method returns a self-referential nested structure where:
-//   - Each node contains direct references to its children nodes in its Children field
-//   - These children nodes in turn contain references to their own children, and so on
-//   - The returned structure is a deep copy of the original nodes to prevent modification
-//     of the internal tree structure
+// RemoveStrategy selects what RemoveNode does with the children of the removed node.
+type RemoveStrategy int
+
+const (
+	RemoveCascade  RemoveStrategy = iota // Delete the node together with all its descendants
+	RemoveReparent                       // Delete only the node and attach its children to its parent
+)
+
+// RemoveNode deletes the specified node from the tree, along with its
+// metadata. With RemoveCascade the whole subtree is deleted. With
+// RemoveReparent the children move up to the node's parent, their ParentID is
+// set to the grandparent's ID and the grandparent's children are re-sorted
+// with the stored sort function, which drops a manual order set with
+// MoveBefore or MoveAfter. Nodes obtained before the call keep their old
+// ParentID, as the moved children are replaced with new node values.
 //
-// This nested structure is particularly useful for:
-// - JSON serialization of the entire tree or subtree
-// - Passing to UI components that render trees
-// - Recursive processing of the tree structure
-// - Extracting a complete subtree for separate handling
+// Returns an error if the node doesn't exist, if the strategy is unknown, or
+// if RemoveReparent is used on a root node, which has no parent to take over
+// its children.
 //
-// Example return structure (with concrete data) for root ID 1:
+// Example:
 //
-//	Node{
-//	    ID: 1,
-//	    ParentID: 0,
-//	    Data: {Title: "Root"},
-//	    Children: [
-//	        Node{
-//	            ID: 2,
-//	            ParentID: 1,
-//	            Data: {Title: "Child 1"},
-//	            Children: [
-//	                Node{ID: 4, ParentID: 2, Data: {Title: "Child 1.1"}, Children: []},
-//	                // ...more children
-//	            ]
-//	        },
-//	        Node{
-//	            ID: 3,
-//	            ParentID: 1,
-//	            Data: {Title: "Child 2"},
-//	            Children: [
-//	                // ...children
-//	            ]
-//	        }
-//	    ]
+//	// Delete a category but keep its subcategories
+//	if err := tree.RemoveNode(categoryID, RemoveReparent); err != nil {
+//	    return err
 //	}
-func (t *Tree[T]) ToTree(rootID int) *Node[T] {
+func (t *Tree[T]) RemoveNode(id int, strategy RemoveStrategy) error {
 	t.Lock()
 	defer t.Unlock()
+	t.invalidateDisplay()
 
-	root, exists := t.nodes[rootID]
+	node, exists := t.nodes[id]
 	if !exists {
-		return nil
+		return nodeErrorf(id, ErrNodeNotFound, "node %d not found", id)
+	}
+
+	switch strategy {
+	case RemoveCascade:
+		t.removeDescendants(id)
+	case RemoveReparent:
+		if node.ParentID == 0 {
+			return fmt.Errorf("cannot reparent the children of root node %d", id)
+		}
+		// Build a new list, slices returned by GetChildren must not change
+		siblings := slices.Clone(t.children[node.ParentID])
+		for _, child := range t.children[id] {
+			moved := &Node[T]{ID: child.ID, ParentID: node.ParentID, Data: child.Data}
+			t.nodes[child.ID] = moved
+			siblings = append(siblings, moved)
+		}
+		t.children[node.ParentID] = siblings
+		delete(t.children, id)
+		delete(t.unsorted, id)
+		delete(t.manual, id)
+		if !t.unsorted[node.ParentID] {
+			t.sortChildren(node.ParentID)
+		}
+	default:
+		return fmt.Errorf("unknown remove strategy %d", strategy)
 	}
 
-	return t.buildTreeRecursive(root)
+	t.detachChild(node)
+	delete(t.nodes, id)
+	delete(t.meta, id)
+	return nil
 }
 
-// buildTreeRecursive recursively builds the tree structure.
-// Creates a deep copy of the node and its children to avoid
-// modifying the original data structure.
-func (t *Tree[T]) buildTreeRecursive(node *Node[T]) *Node[T] {
-	children := t.children[node.ID]
-	if len(children) == 0 {
-		return node
-	}
+// RemoveChildren deletes the entire subtree below the specified node, keeping
+// the node itself, e.g. to clear the contents of a folder.
+// Metadata attached to the removed nodes is dropped as well.
+// Returns the number of removed nodes, which is 0 for a leaf or missing node.
+// The root sentinel 0 is not a node, so RemoveChildren(0) removes nothing;
+// use Clear to empty the tree.
+//
+// Example:
+//
+//	removed := tree.RemoveChildren(folderID)
+//	fmt.Printf("Deleted %d items\n", removed)
+func (t *Tree[T]) RemoveChildren(id int) int {
+	t.Lock()
+	defer t.Unlock()
 
-	// Create a new node to avoid modifying the original
-	newNode := &Node[T]{
-		ID:       node.ID,
-		ParentID: node.ParentID,
-		Data:     node.Data,
-		Children: make([]*Node[T], len(children)),
+	if _, ok := t.nodes[id]; !ok {
+		return 0
 	}
+	t.invalidateDisplay()
+	return t.removeDescendants(id)
+}
 
-	// Recursively build children
-	for i, child := range children {
-		newNode.Children[i] = t.buildTreeRecursive(child)
+// removeDescendants deletes all descendants of id from the node, children,
+// metadata and pending sort maps, and returns how many nodes were removed.
+// The caller must hold the write lock.
+func (t *Tree[T]) removeDescendants(id int) int {
+	removed := 0
+	stack := []int{id}
+	for len(stack) > 0 {
+		parentID := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, child := range t.children[parentID] {
+			delete(t.nodes, child.ID)
+			delete(t.meta, child.ID)
+			stack = append(stack, child.ID)
+			removed++
+		}
+		delete(t.children, parentID)
+		delete(t.unsorted, parentID)
+		delete(t.manual, parentID)
 	}
+	return removed
+}
+
+// FormatStyle names a preset set of icons and indentation for
+// FormatTreeDisplay, so switching between terminal and log file
+// rendering doesn't require spelling out FormatOption.Icons.
+type FormatStyle string
+
+const (
+	StyleUnicode FormatStyle = "unicode" // │ ├ └, the default icons
+	StyleASCII   FormatStyle = "ascii"   // | +- `-, safe for plain-text logs
+	StyleRounded FormatStyle = "rounded" // │ ├─ ╰─, with rounded corners
+)
 
-	return newNode
+// formatStyles holds the icons and indentation of each FormatStyle.
+var formatStyles = map[FormatStyle]struct {
+	icons  []string
+	indent string
+}{
+	StyleUnicode: {icons: []string{"│", "├ ", "└ "}, indent: " "},
+	StyleASCII:   {icons: []string{"|", "+- ", "`- "}, indent: " "},
+	StyleRounded: {icons: []string{"│", "├─ ", "╰─ "}, indent: " "},
 }
 
 // FormatOption defines configuration for tree formatting.
@@ -766,10 +4426,18 @@ func (t *Tree[T]) buildTreeRecursive(node *Node[T]) *Node[T] {
 //	}
 //
 //	formatted := tree.FormatTreeDisplay(1, opt)
+//
+// Or with a preset style:
+//
+//	formatted := tree.FormatTreeDisplay(1, FormatOption{Style: tree.StyleASCII})
 type FormatOption struct {
-	DisplayField string   // Field name to display from node data (default: "title")
-	Indent       string   // Indentation string for each level (default: " ")
-	Icons        []string // Formatting icons [vertical, branch, last] (default: ["│", "├ ", "└ "])
+	DisplayField  string      // Field name, or dotted path like "Profile.Name", to display from node data (default: "title")
+	DisplayFields []string    // Several field names to display, takes precedence over DisplayField
+	FieldSep      string      // Separator between the DisplayFields values (default: " ")
+	Indent        string      // Indentation string for each level (default: " ")
+	Icons         []string    // Formatting icons [vertical, branch, last] (default: ["│", "├ ", "└ "])
+	Style         FormatStyle // Preset icons and indentation, takes precedence over Icons; unknown styles are ignored
+	Plain         bool        // Omit the icons, indenting each node by Indent repeated once per level
 }
 
 // FormattedNode extends Node with display formatting information.
@@ -809,10 +4477,18 @@ func DefaultFormatOption() FormatOption {
 //
 // Parameters:
 //   - rootID: ID of the starting node
-//   - opt.DisplayField: field name from Node.Data to display (defaults to "title")
+//   - opt.DisplayField: field name from Node.Data to display (defaults to "title");
+//     string fields are shown as is, other fields are formatted with fmt's %v verb
+//   - opt.DisplayFields: several field names to display instead of DisplayField,
+//     joined by opt.FieldSep (defaults to " "); missing fields are skipped
 //   - opt.Indent: indentation string for each level (defaults to " ")
 //   - opt.Icons: array of 3 icons for formatting: [vertical line, branch, last branch]
-//     default: ["│", "├ ", "└ "]
+//     default: ["│", "├ ", "└ "]; any other length falls back to the default
+//   - opt.Style: a preset (StyleUnicode, StyleASCII, StyleRounded) that sets Icons,
+//     and Indent unless it is given explicitly
+//   - opt.Plain: render a plain-text outline without icons, each node indented
+//     by opt.Indent once per level below the root, e.g. "    Child 1.2.1" with
+//     Indent "  " (useful for logs and tools that can't handle box characters)
 //
 // Example return structure for root ID 1:
 //
@@ -825,99 +4501,361 @@ func DefaultFormatOption() FormatOption {
 //	    {ID: 6, DisplayName: "     └ Child 2.1"}
 //	]
 //
+// Returns an empty slice if the root node doesn't exist.
+// Use FormatTreeDisplayE to get an error in that case instead.
+//
+// The result is cached per root and options until the tree changes, so
+// repeated calls on an unchanged tree only copy the cached rows.
+// The cache keeps the 8 most recently formatted results, each holding a row
+// per node of its subtree, so it can use up to 8 times the memory of a full
+// display. When rendering many different roots or options once each, use
+// FormatTreeDisplayNoCache, which skips the cache.
+//
 // Thread-safe: uses internal thread-safe methods.
 func (t *Tree[T]) FormatTreeDisplay(rootID int, opt FormatOption) []FormattedNode[T] {
-	// Apply default options if needed
+	opt = formatDefaults(opt)
+	key := newDisplayKey(rootID, opt)
+
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	t.displayMu.Lock()
+	formatted, cached := t.display[key]
+	t.displayMu.Unlock()
+	if !cached {
+		formatted = make([]FormattedNode[T], 0)
+		t.formatTree(rootID, opt, fieldLabel[T](opt), nil, &formatted)
+
+		t.displayMu.Lock()
+		t.cacheDisplay(key, formatted)
+		t.displayMu.Unlock()
+	}
+
+	// Copy so callers can't change the cached rows
+	return slices.Clone(formatted)
+}
+
+// FormatTreeDisplayNoCache works like FormatTreeDisplay but always formats the
+// tree from scratch, without reading or filling the display cache. Use it for
+// one-off renders, e.g. of many different roots, that are not worth keeping.
+func (t *Tree[T]) FormatTreeDisplayNoCache(rootID int, opt FormatOption) []FormattedNode[T] {
+	return t.FormatTreeDisplayCollapsed(rootID, nil, opt)
+}
+
+// FormatTreeDisplayCollapsed works like FormatTreeDisplay but only renders the
+// visible rows of an interactive tree. A node whose ID is set in collapsed is
+// rendered itself, but its descendants are skipped. Collapsing never hides
+// siblings, so the connector lines of the visible rows stay the same as in
+// the full display.
+//
+// Example:
+//
+//	collapsed := map[int]bool{2: true}
+//	rows := tree.FormatTreeDisplayCollapsed(1, collapsed, tree.DefaultFormatOption())
+//	// Root
+//	//  ├ Child 1
+//	//  └ Child 2
+//	//    └ Child 2.1
+func (t *Tree[T]) FormatTreeDisplayCollapsed(rootID int, collapsed map[int]bool, opt FormatOption) []FormattedNode[T] {
+	opt = formatDefaults(opt)
+	return t.formatTreeDisplay(rootID, opt, fieldLabel[T](opt), collapsed)
+}
+
+// FormatTreeDisplayFunc works like FormatTreeDisplay but computes each label
+// by calling label with the node's data instead of reading the display fields,
+// which avoids reflection and works for any T, e.g. a Tree[string].
+// The DisplayField, DisplayFields and FieldSep options are ignored.
+//
+// Results are never cached, as functions can't be compared.
+// label must not call any method of the tree, as the read lock is held while
+// it runs.
+//
+// Example:
+//
+//	rows := tree.FormatTreeDisplayFunc(1, func(c Category) string {
+//	    return c.Name + " (" + c.Code + ")"
+//	}, tree.DefaultFormatOption())
+func (t *Tree[T]) FormatTreeDisplayFunc(rootID int, label func(T) string, opt FormatOption) []FormattedNode[T] {
+	return t.formatTreeDisplay(rootID, formatDefaults(opt), func(data T) (string, bool) {
+		return label(data), true
+	}, nil)
+}
+
+// formatTreeDisplay formats the tree below rootID without the display cache.
+// opt must have its defaults applied.
+func (t *Tree[T]) formatTreeDisplay(rootID int, opt FormatOption, label func(T) (string, bool), collapsed map[int]bool) []FormattedNode[T] {
+	t.rLockSorted()
+	defer t.RUnlock()
+
+	formatted := make([]FormattedNode[T], 0)
+	t.formatTree(rootID, opt, label, collapsed, &formatted)
+	return formatted
+}
+
+// formatDefaults returns opt with the defaults applied to its empty options
+// and the icons of its style, if any.
+func formatDefaults(opt FormatOption) FormatOption {
 	if opt.DisplayField == "" {
 		opt.DisplayField = DefaultFormatOption().DisplayField
 	}
+	if opt.FieldSep == "" {
+		opt.FieldSep = " "
+	}
+	if style, ok := formatStyles[opt.Style]; ok {
+		opt.Icons = style.icons
+		if opt.Indent == "" {
+			opt.Indent = style.indent
+		}
+	}
 	if opt.Indent == "" {
 		opt.Indent = DefaultFormatOption().Indent
 	}
 	if len(opt.Icons) != 3 {
 		opt.Icons = DefaultFormatOption().Icons
 	}
+	return opt
+}
+
+// displayKey identifies a cached FormatTreeDisplay result by its root and
+// the options with their defaults applied. The slices are flattened into
+// strings with a NUL before each element, as a FormatOption itself is not
+// comparable.
+type displayKey struct {
+	rootID int
+	field  string
+	fields string
+	sep    string
+	indent string
+	icons  string
+	plain  bool
+}
+
+func newDisplayKey(rootID int, opt FormatOption) displayKey {
+	flatten := func(values []string) string {
+		var sb strings.Builder
+		for _, v := range values {
+			sb.WriteByte(0)
+			sb.WriteString(v)
+		}
+		return sb.String()
+	}
+	return displayKey{
+		rootID: rootID,
+		field:  opt.DisplayField,
+		fields: flatten(opt.DisplayFields),
+		sep:    opt.FieldSep,
+		indent: opt.Indent,
+		icons:  flatten(opt.Icons),
+		plain:  opt.Plain,
+	}
+}
 
-	t.Lock()
-	defer t.Unlock()
+// maxDisplayCache is the number of FormatTreeDisplay results kept per tree.
+const maxDisplayCache = 8
 
-	formatted := make([]FormattedNode[T], 0)
-	t.formatTreeRecursive(rootID, opt, "", &formatted)
-	return formatted
+// cacheDisplay stores a FormatTreeDisplay result, evicting the oldest one once
+// maxDisplayCache results are cached. The caller must hold displayMu.
+func (t *Tree[T]) cacheDisplay(key displayKey, formatted []FormattedNode[T]) {
+	if _, exists := t.display[key]; exists {
+		// Another reader formatted the same rows meanwhile
+		return
+	}
+	if t.display == nil {
+		t.display = make(map[displayKey][]FormattedNode[T])
+	}
+	if len(t.displayOrder) == maxDisplayCache {
+		delete(t.display, t.displayOrder[0])
+		t.displayOrder = t.displayOrder[1:]
+	}
+	t.display[key] = formatted
+	t.displayOrder = append(t.displayOrder, key)
+}
+
+// invalidateDisplay drops the cached FormatTreeDisplay results.
+// Every method that changes nodes or children lists must call it.
+// The caller must hold the write lock, which keeps readers out of the cache.
+func (t *Tree[T]) invalidateDisplay() {
+	t.display = nil
+	t.displayOrder = nil
 }
 
-// formatTreeRecursive is an internal helper function that recursively builds
-// the formatted tree structure. It handles the proper indentation and
-// formatting of each node based on its position in the tree.
+// FormatTreeDisplayE works like FormatTreeDisplay but returns an error
+// if the root node doesn't exist, instead of a silent empty result.
 //
-// Parameters:
-//   - rootID: current node's ID
-//   - displayField: field to display from node's Data
-//   - space: current indentation string
-//   - indent: indentation string for each level
-//   - indentIcons: formatting icons [vertical line, branch, last branch]
-//     default: ["│", "├ ", "└ "]
-//   - formatted: pointer to result slice
-func (t *Tree[T]) formatTreeRecursive(nodeID int, opt FormatOption, space string, result *[]FormattedNode[T]) {
+// Example:
+//
+//	formatted, err := tree.FormatTreeDisplayE(rootID, tree.DefaultFormatOption())
+//	if err != nil {
+//	    http.NotFound(w, r)
+//	    return
+//	}
+func (t *Tree[T]) FormatTreeDisplayE(rootID int, opt FormatOption) ([]FormattedNode[T], error) {
+	if _, exists := t.FindNode(rootID); !exists {
+		return nil, nodeErrorf(rootID, ErrNodeNotFound, "root node %d not found", rootID)
+	}
+	return t.FormatTreeDisplay(rootID, opt), nil
+}
+
+// formatTree builds the formatted tree structure starting at nodeID.
+// It handles the proper indentation and formatting of each node
+// based on its position in the tree.
+// It uses an explicit stack instead of recursion so that very deep trees
+// cannot exhaust the goroutine stack.
+//
+// Each child's display name is built from its parent's indentation
+// ("space"), followed by the branch icon and the display value.
+// The indentation for the next level is space + pad + opt.Indent, where pad
+// is the vertical line icon if the child has further siblings below it.
+// The indentations of the current path are kept in a single buffer with the
+// end offset of each level, so entering a level appends to the buffer and
+// leaving it truncates, instead of concatenating a new string per node.
+// With opt.Plain, pre and pad are empty, so a node at depth d is indented
+// by opt.Indent repeated d times.
+// Labels come from label, and the root is skipped if it has none.
+// The children of nodes set in collapsed are not visited.
+func (t *Tree[T]) formatTree(nodeID int, opt FormatOption, label func(T) (string, bool), collapsed map[int]bool, result *[]FormattedNode[T]) {
 	node, exists := t.nodes[nodeID]
 	if !exists {
 		return
 	}
 
-	if space == "" {
-		v := reflect.ValueOf(node.Data)
-		if v.Kind() == reflect.Struct {
-			if f := v.FieldByName(opt.DisplayField); f.IsValid() && f.CanInterface() {
-				if str, ok := f.Interface().(string); ok {
-					*result = append(*result, FormattedNode[T]{
-						Node:        node,
-						DisplayName: str,
-					})
-				}
-			}
-		}
-		space = opt.Indent
+	if str, ok := label(node.Data); ok {
+		*result = append(*result, FormattedNode[T]{
+			Node:        node,
+			DisplayName: str,
+		})
 	}
 
-	children := t.children[nodeID]
-	if len(children) == 0 {
-		return
+	type frame struct {
+		node   *Node[T]
+		depth  int  // Level below nodeID, 1 for its children
+		isLast bool // Whether the node is the last of its siblings
 	}
 
-	var pre, pad string
-	for i, child := range children {
-		// Check if it's the last child
-		isLast := i == len(children)-1
+	// pushChildren pushes the children in reverse so the first child is processed first
+	var stack []frame
+	pushChildren := func(parentID, depth int) {
+		if collapsed[parentID] {
+			return
+		}
+		children := t.children[parentID]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{
+				node:   children[i],
+				depth:  depth,
+				isLast: i == len(children)-1,
+			})
+		}
+	}
+	pushChildren(nodeID, 1)
 
-		pad = "" // Reset pad for each child
-		if isLast {
+	// spaces holds the indentation of each level on the current path,
+	// level d ending at ends[d-1]
+	spaces := []byte(opt.Indent)
+	ends := []int{len(spaces)}
+	var sb strings.Builder
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Drop the levels of the previous branch
+		ends = ends[:current.depth]
+		spaces = spaces[:ends[current.depth-1]]
+
+		// Plain outlines have no icons, so the indentation alone shows the depth
+		var pre, pad string
+		if current.isLast && !opt.Plain {
 			pre = opt.Icons[2] // "└ "
-		} else {
+		} else if !opt.Plain {
 			pre = opt.Icons[1] // "├ "
-			if space != "" {
+			if len(spaces) > 0 {
 				pad = opt.Icons[0] // "│"
 			}
 		}
 
-		displayName := space + pre
-
-		// Get display value using reflection
-		v := reflect.ValueOf(child.Data)
-		if v.Kind() == reflect.Struct {
-			if f := v.FieldByName(opt.DisplayField); f.IsValid() && f.CanInterface() {
-				if str, ok := f.Interface().(string); ok {
-					displayName += str
-				}
-			}
-		}
+		str, _ := label(current.node.Data)
+		sb.Grow(len(spaces) + len(pre) + len(str))
+		sb.Write(spaces)
+		sb.WriteString(pre)
+		sb.WriteString(str)
 
 		*result = append(*result, FormattedNode[T]{
-			Node:        child,
-			DisplayName: displayName,
+			Node:        current.node,
+			DisplayName: sb.String(),
 		})
+		sb.Reset()
 
-		// Recursively process child nodes
 		// space+pad+indent is the new space for the next level
-		t.formatTreeRecursive(child.ID, opt, space+pad+opt.Indent, result)
+		if len(t.children[current.node.ID]) > 0 {
+			spaces = append(append(spaces, pad...), opt.Indent...)
+			ends = append(ends, len(spaces))
+			pushChildren(current.node.ID, current.depth+1)
+		}
+	}
+}
+
+// fieldLabel returns a label function that reads the display fields of opt.
+func fieldLabel[T any](opt FormatOption) func(T) (string, bool) {
+	return func(data T) (string, bool) {
+		return displayLabel(data, opt)
+	}
+}
+
+// displayLabel returns the label of data according to opt.
+// With DisplayFields set, the values of the fields that exist are joined by
+// FieldSep, and ok is false only if none of them exists. Otherwise the single
+// DisplayField is used.
+func displayLabel[T any](data T, opt FormatOption) (string, bool) {
+	if len(opt.DisplayFields) == 0 {
+		return displayValue(data, opt.DisplayField)
+	}
+
+	values := make([]string, 0, len(opt.DisplayFields))
+	for _, field := range opt.DisplayFields {
+		if str, ok := displayValue(data, field); ok {
+			values = append(values, str)
+		}
+	}
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, opt.FieldSep), true
+}
+
+// displayValue returns the value of the named field of data using reflection.
+// The field may be a dotted path into nested structs, such as "Profile.Name";
+// pointers along the path are followed.
+// String fields are returned as is, fmt.Stringer values through their String
+// method, and other fields are formatted with fmt.
+// Returns ("", false) if data is not a struct, or a field on the path is
+// missing, unexported or behind a nil pointer.
+func displayValue[T any](data T, field string) (string, bool) {
+	v := reflect.ValueOf(data)
+	for path, more := field, true; more; {
+		var name string
+		name, path, more = strings.Cut(path, ".")
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return "", false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return "", false
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() || !v.CanInterface() {
+			return "", false
+		}
+	}
+
+	value := v.Interface()
+	if str, ok := value.(string); ok {
+		return str, true
+	}
+	// A nil pointer Stringer is left to fmt, which prints <nil> instead of panicking
+	if stringer, ok := value.(fmt.Stringer); ok && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+		return stringer.String(), true
 	}
+	return fmt.Sprintf("%v", value), true
 }
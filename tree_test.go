@@ -1,11 +1,19 @@
 package tree
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 type TestCategory struct {
@@ -207,6 +215,18 @@ func TestLoadDataFormat(t *testing.T) {
 			//wantErr: "circular reference detected at node 1",
 			wantErr: "circular reference detected",
 		},
+		{
+			name: "Self-parented node",
+			data: []TestCategory{
+				{ID: 1, ParentID: 0, Title: "Root"},
+				{ID: 2, ParentID: 2, Title: "Self"},
+			},
+			options: []LoadOption[TestCategory]{
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+			},
+			wantErr: "node 2: node is its own parent",
+		},
 		{
 			name: "Valid single root",
 			data: []TestCategory{
@@ -867,6 +887,55 @@ func TestConcurrency(t *testing.T) {
 	wg.Wait()
 }
 
+func TestReadOnlyMethodsShareReadLock(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Title"
+	want := tree.FormatTreeDisplay(1, opt)
+
+	// With a reader holding the lock, a method taking the write lock would
+	// block until the timeout
+	tree.RLock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tree.GetSiblings(4, false)
+		tree.ToTree(1)
+		tree.FormatTreeDisplay(1, opt)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("GetSiblings, ToTree or FormatTreeDisplay blocked behind a concurrent reader")
+	}
+	tree.RUnlock()
+	<-done
+
+	// Many concurrent renders, run with -race to check for data races
+	var wg sync.WaitGroup
+	numGoroutines := 100
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if got := tree.FormatTreeDisplay(1, opt); !reflect.DeepEqual(got, want) {
+					t.Errorf("concurrent FormatTreeDisplay() = %v, want %v", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestEdgeCases(t *testing.T) {
 	tree := New[TestCategory]()
 	err := tree.Load(getTestData(),
@@ -900,8 +969,8 @@ func TestEdgeCases(t *testing.T) {
 
 	t.Run("InvalidDepth", func(t *testing.T) {
 		descendants := tree.GetDescendants(1, -1)
-		if descendants != nil {
-			t.Error("Negative depth should return nil")
+		if descendants == nil || len(descendants) != 0 {
+			t.Error("Negative depth should return an empty slice")
 		}
 	})
 }
@@ -1293,3 +1362,5039 @@ func TestGetNodePath(t *testing.T) {
 		})
 	}
 }
+
+func TestExportEnriched(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	enriched := tree.ExportEnriched()
+	if len(enriched) != len(getTestData()) {
+		t.Fatalf("ExportEnriched() got %d nodes, want %d", len(enriched), len(getTestData()))
+	}
+
+	// Every row must agree with the per-node path and depth
+	for _, row := range enriched {
+		wantPath := tree.GetNodePath(row.ID, true)
+		if !reflect.DeepEqual(row.Path, wantPath) {
+			t.Errorf("node %d path = %v, want %v", row.ID, row.Path, wantPath)
+		}
+		if row.Depth != len(wantPath)-1 {
+			t.Errorf("node %d depth = %d, want %d", row.ID, row.Depth, len(wantPath)-1)
+		}
+		if row.Data.ID != row.ID || row.Data.ParentID != row.ParentID {
+			t.Errorf("node %d data mismatch: %+v", row.ID, row.Data)
+		}
+	}
+
+	// Rows follow depth-first order
+	wantOrder := []int{1, 2, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 3, 6}
+	gotOrder := make([]int, len(enriched))
+	for i, row := range enriched {
+		gotOrder[i] = row.ID
+	}
+	if !reflect.DeepEqual(gotOrder, wantOrder) {
+		t.Errorf("ExportEnriched() order = %v, want %v", gotOrder, wantOrder)
+	}
+
+	if got := New[TestCategory]().ExportEnriched(); len(got) != 0 {
+		t.Errorf("ExportEnriched() on empty tree got %d nodes, want 0", len(got))
+	}
+}
+
+func TestFormatTreeDisplayMissingRoot(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Title"
+
+	// FormatTreeDisplay silently returns an empty result
+	if formatted := tree.FormatTreeDisplay(999, opt); len(formatted) != 0 {
+		t.Errorf("FormatTreeDisplay() got %d nodes for missing root, want 0", len(formatted))
+	}
+
+	formatted, err := tree.FormatTreeDisplayE(999, opt)
+	if err == nil || err.Error() != "root node 999 not found" {
+		t.Errorf("FormatTreeDisplayE() error = %v, want %q", err, "root node 999 not found")
+	}
+	if formatted != nil {
+		t.Errorf("FormatTreeDisplayE() got %v, want nil", formatted)
+	}
+
+	formatted, err = tree.FormatTreeDisplayE(3, opt)
+	if err != nil {
+		t.Fatalf("FormatTreeDisplayE() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(formatted, tree.FormatTreeDisplay(3, opt)) {
+		t.Errorf("FormatTreeDisplayE() = %v, want same as FormatTreeDisplay", formatted)
+	}
+}
+
+func TestToCustom(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	type menuItem struct {
+		Name  string
+		Nodes []menuItem
+	}
+	build := func(c TestCategory, nodes []menuItem) menuItem {
+		return menuItem{Name: c.Title, Nodes: nodes}
+	}
+
+	got := ToCustom(tree.ToTree(3), build)
+	want := menuItem{
+		Name:  "Child 2",
+		Nodes: []menuItem{{Name: "Child 2.1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToCustom() = %+v, want %+v", got, want)
+	}
+
+	// Child order must follow the stored sort order
+	root := ToCustom(tree.ToTree(1), build)
+	names := make([]string, len(root.Nodes))
+	for i, n := range root.Nodes {
+		names[i] = n.Name
+	}
+	if !reflect.DeepEqual(names, []string{"Child 1", "Child 2"}) {
+		t.Errorf("ToCustom() root children = %v, want [Child 1 Child 2]", names)
+	}
+
+	if got := ToCustom(tree.ToTree(999), build); !reflect.DeepEqual(got, menuItem{}) {
+		t.Errorf("ToCustom(nil) = %+v, want zero value", got)
+	}
+}
+
+func TestWidthByDepth(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	want := []int{1, 2, 4, 2, 2, 2, 2, 2}
+	if got := tree.WidthByDepth(); !reflect.DeepEqual(got, want) {
+		t.Errorf("WidthByDepth() = %v, want %v", got, want)
+	}
+
+	// Multiple roots are counted together at depth 0
+	forest := New[TestCategory]()
+	err = forest.Load([]TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root 1"},
+		{ID: 2, ParentID: 0, Title: "Root 2"},
+		{ID: 3, ParentID: 1, Title: "Child 1"},
+	},
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if got := forest.WidthByDepth(); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("WidthByDepth() = %v, want [2 1]", got)
+	}
+
+	if got := New[TestCategory]().WidthByDepth(); got == nil || len(got) != 0 {
+		t.Errorf("WidthByDepth() on empty tree = %#v, want empty slice", got)
+	}
+}
+
+func TestNodesInDepthRange(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		minDepth int
+		maxDepth int
+		wantIDs  []int
+	}{
+		{"Roots only", 0, 0, []int{1}},
+		{"Depth band", 1, 2, []int{2, 3, 4, 5, 17, 6}},
+		{"Single deep level", 7, 7, []int{15, 16}},
+		{"Beyond tree height", 10, 20, []int{}},
+		{"Negative min depth", -5, 1, []int{1, 2, 3}},
+		{"Inverted range", 3, 1, []int{}},
+		{"Negative max depth", -2, -1, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.NodesInDepthRange(tt.minDepth, tt.maxDepth)
+			if nodes == nil {
+				t.Fatalf("NodesInDepthRange(%d, %d) = nil, want non-nil", tt.minDepth, tt.maxDepth)
+			}
+
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("NodesInDepthRange(%d, %d) = %v, want %v", tt.minDepth, tt.maxDepth, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestAreSiblings(t *testing.T) {
+	tree := New[TestCategory]()
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root 1"},
+		{ID: 2, ParentID: 0, Title: "Root 2"},
+		{ID: 3, ParentID: 1, Title: "Child 1"},
+		{ID: 4, ParentID: 1, Title: "Child 2"},
+		{ID: 5, ParentID: 2, Title: "Child 3"},
+	}
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		a, b int
+		want bool
+	}{
+		{"Same parent", 3, 4, true},
+		{"Symmetric", 4, 3, true},
+		{"Both roots", 1, 2, true},
+		{"Cousins", 3, 5, false},
+		{"Parent and child", 1, 3, false},
+		{"Same node", 3, 3, false},
+		{"Missing node", 3, 999, false},
+		{"Both missing", 998, 999, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.AreSiblings(tt.a, tt.b); got != tt.want {
+				t.Errorf("AreSiblings(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSubtreeChildrenMap(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	titles := func(items []TestCategory) []string {
+		result := make([]string, len(items))
+		for i, item := range items {
+			result[i] = item.Title
+		}
+		return result
+	}
+
+	got := tree.GetSubtreeChildrenMap(8)
+	want := map[int][]string{
+		8:  {"Child 1.2.2.1", "Child 1.2.2.2"},
+		10: {"Child 1.2.2.2.1", "Child 1.2.2.2.2"},
+		12: {"Child 1.2.2.2.2.1", "Child 1.2.2.2.2.2"},
+		14: {"Child 1.2.2.2.2.2.1", "Child 1.2.2.2.2.2.2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetSubtreeChildrenMap(8) got %d parents, want %d", len(got), len(want))
+	}
+	for parentID, wantTitles := range want {
+		if gotTitles := titles(got[parentID]); !reflect.DeepEqual(gotTitles, wantTitles) {
+			t.Errorf("GetSubtreeChildrenMap(8)[%d] = %v, want %v", parentID, gotTitles, wantTitles)
+		}
+	}
+
+	// Whole tree covers every non-leaf node
+	if got := tree.GetSubtreeChildrenMap(1); len(got) != 8 {
+		t.Errorf("GetSubtreeChildrenMap(1) got %d parents, want 8", len(got))
+	}
+
+	if got := tree.GetSubtreeChildrenMap(4); got == nil || len(got) != 0 {
+		t.Errorf("GetSubtreeChildrenMap(4) = %v, want empty map for leaf", got)
+	}
+
+	if got := tree.GetSubtreeChildrenMap(999); got == nil || len(got) != 0 {
+		t.Errorf("GetSubtreeChildrenMap(999) = %v, want empty map", got)
+	}
+}
+
+// buildChain returns n nodes where each node is the only child of the previous one.
+func buildChain(n int) []TestCategory {
+	data := make([]TestCategory, n)
+	for i := range data {
+		data[i] = TestCategory{
+			ID:       i + 1,
+			ParentID: i,
+			Title:    fmt.Sprintf("Node %d", i+1),
+		}
+	}
+	return data
+}
+
+func TestDeepChain(t *testing.T) {
+	const depth = 50000
+
+	tree := New[TestCategory]()
+	err := tree.Load(buildChain(depth),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	t.Run("GetDescendants", func(t *testing.T) {
+		descendants := tree.GetDescendants(1, 0)
+		if len(descendants) != depth-1 {
+			t.Fatalf("GetDescendants() got %d nodes, want %d", len(descendants), depth-1)
+		}
+		for i, node := range descendants {
+			if node.ID != i+2 {
+				t.Fatalf("descendant %d has ID %d, want %d", i, node.ID, i+2)
+			}
+		}
+
+		if got := tree.GetDescendants(1, 100); len(got) != 100 {
+			t.Errorf("GetDescendants(1, 100) got %d nodes, want 100", len(got))
+		}
+	})
+
+	t.Run("ToTree", func(t *testing.T) {
+		node := tree.ToTree(1)
+		count := 0
+		for node != nil {
+			count++
+			if len(node.Children) == 0 {
+				break
+			}
+			node = node.Children[0]
+		}
+		if count != depth {
+			t.Errorf("ToTree() nested depth = %d, want %d", count, depth)
+		}
+	})
+
+	t.Run("FormatTreeDisplay", func(t *testing.T) {
+		// Display names grow with depth, so the output size is quadratic;
+		// format a shorter section of the chain to keep the test light.
+		opt := DefaultFormatOption()
+		opt.DisplayField = "Title"
+		formatted := tree.FormatTreeDisplay(depth-5000, opt)
+		if len(formatted) != 5001 {
+			t.Fatalf("FormatTreeDisplay() got %d nodes, want 5001", len(formatted))
+		}
+		last := formatted[len(formatted)-1]
+		want := strings.Repeat(" ", 5000) + "└ " + fmt.Sprintf("Node %d", depth)
+		if last.DisplayName != want {
+			t.Errorf("last display name has length %d, want %d", len(last.DisplayName), len(want))
+		}
+	})
+
+	t.Run("ExportEnriched", func(t *testing.T) {
+		// Every node carries its full path, so the output size is quadratic;
+		// export a shorter chain to keep the test light.
+		const depth = 2000
+		chain := New[TestCategory]()
+		err := chain.Load(buildChain(depth),
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		exported := chain.ExportEnriched()
+		if len(exported) != depth {
+			t.Fatalf("ExportEnriched() got %d nodes, want %d", len(exported), depth)
+		}
+		last := exported[len(exported)-1]
+		if last.ID != depth || last.Depth != depth-1 || len(last.Path) != depth || last.Path[0] != 1 || last.Path[depth-1] != depth {
+			t.Errorf("last node = ID %d, depth %d, path length %d, want ID %d at depth %d", last.ID, last.Depth, len(last.Path), depth, depth-1)
+		}
+	})
+}
+
+func BenchmarkGetDescendantsDeepChain(b *testing.B) {
+	tree := New[TestCategory]()
+	err := tree.Load(buildChain(50000),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		b.Fatalf("Failed to load test data: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree.GetDescendants(1, 0)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tree.SetMeta(2, "expanded", true)
+	tree.SetMeta(2, "selected", false)
+	tree.SetMeta(2, "expanded", false) // Overwrite
+
+	if value, ok := tree.GetMeta(2, "expanded"); !ok || value != false {
+		t.Errorf("GetMeta(2, expanded) = %v, %v, want false, true", value, ok)
+	}
+	if value, ok := tree.GetMeta(2, "selected"); !ok || value != false {
+		t.Errorf("GetMeta(2, selected) = %v, %v, want false, true", value, ok)
+	}
+	if value, ok := tree.GetMeta(2, "missing"); ok || value != nil {
+		t.Errorf("GetMeta(2, missing) = %v, %v, want nil, false", value, ok)
+	}
+	if _, ok := tree.GetMeta(3, "expanded"); ok {
+		t.Error("GetMeta(3, expanded) found metadata on a node without any")
+	}
+
+	// Setting metadata on a missing node is ignored
+	tree.SetMeta(999, "expanded", true)
+	if _, ok := tree.GetMeta(999, "expanded"); ok {
+		t.Error("GetMeta(999, expanded) found metadata on a missing node")
+	}
+
+	// Load clears all metadata
+	err = tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to reload test data: %v", err)
+	}
+	if _, ok := tree.GetMeta(2, "expanded"); ok {
+		t.Error("GetMeta(2, expanded) found metadata after reload")
+	}
+}
+
+func TestGetChildrenWhere(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		id      int
+		match   func(TestCategory) bool
+		wantIDs []int
+	}{
+		{
+			name:    "Skip middle child",
+			id:      2,
+			match:   func(c TestCategory) bool { return c.ID != 5 },
+			wantIDs: []int{4, 17},
+		},
+		{
+			name:    "Match all",
+			id:      2,
+			match:   func(c TestCategory) bool { return true },
+			wantIDs: []int{4, 5, 17},
+		},
+		{
+			name:    "Match none",
+			id:      2,
+			match:   func(c TestCategory) bool { return false },
+			wantIDs: []int{},
+		},
+		{
+			name:    "Leaf node",
+			id:      4,
+			match:   func(c TestCategory) bool { return true },
+			wantIDs: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children := tree.GetChildrenWhere(tt.id, tt.match)
+			ids := make([]int, len(children))
+			for i, child := range children {
+				ids[i] = child.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetChildrenWhere(%d) = %v, want %v", tt.id, ids, tt.wantIDs)
+			}
+		})
+	}
+
+	// Modifying the result must not affect the tree
+	children := tree.GetChildrenWhere(2, func(c TestCategory) bool { return true })
+	children[0], children[2] = children[2], children[0]
+	if ids := tree.GetChildrenIDs(2); !reflect.DeepEqual(ids, []int{4, 5, 17}) {
+		t.Errorf("GetChildrenIDs(2) = %v after modifying result, want [4 5 17]", ids)
+	}
+}
+
+func TestLazySort(t *testing.T) {
+	sortByTitleDesc := WithSort(func(a, b TestCategory) bool { return a.Title > b.Title })
+
+	eager := New[TestCategory]()
+	err := eager.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		sortByTitleDesc,
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	newLazy := func(t *testing.T) *Tree[TestCategory] {
+		lazy := New[TestCategory]()
+		err := lazy.Load(getTestData(),
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+			sortByTitleDesc,
+			WithLazySort[TestCategory](),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		return lazy
+	}
+
+	t.Run("Deferred until read", func(t *testing.T) {
+		lazy := newLazy(t)
+		if len(lazy.unsorted) == 0 {
+			t.Fatal("expected children lists to be pending after lazy load")
+		}
+
+		// GetChildren only sorts the requested list
+		pending := len(lazy.unsorted)
+		if got, want := lazy.GetChildrenIDs(2), eager.GetChildrenIDs(2); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetChildrenIDs(2) = %v, want %v", got, want)
+		}
+		if len(lazy.unsorted) != pending-1 || lazy.unsorted[2] {
+			t.Errorf("expected only parent 2 to be sorted, %d of %d lists still pending", len(lazy.unsorted), pending)
+		}
+	})
+
+	t.Run("Same results as eager", func(t *testing.T) {
+		lazy := newLazy(t)
+		if got, want := lazy.GetDescendantsIDs(1, 0), eager.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetDescendantsIDs(1, 0) = %v, want %v", got, want)
+		}
+		if len(lazy.unsorted) != 0 {
+			t.Errorf("expected all lists sorted after traversal, %d still pending", len(lazy.unsorted))
+		}
+
+		opt := DefaultFormatOption()
+		opt.DisplayField = "Title"
+		lazy = newLazy(t)
+		if got, want := lazy.FormatTreeDisplay(1, opt), eager.FormatTreeDisplay(1, opt); !reflect.DeepEqual(got, want) {
+			t.Errorf("FormatTreeDisplay() = %v, want %v", got, want)
+		}
+
+		lazy = newLazy(t)
+		if got, want := lazy.GetSiblingsIDs(4, true), eager.GetSiblingsIDs(4, true); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetSiblingsIDs(4, true) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Concurrent first reads", func(t *testing.T) {
+		lazy := newLazy(t)
+		want := eager.GetDescendantsIDs(1, 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				lazy.GetChildren(5)
+			}()
+			go func() {
+				defer wg.Done()
+				if got := lazy.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, want) {
+					t.Errorf("GetDescendantsIDs(1, 0) = %v, want %v", got, want)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func BenchmarkLoad(b *testing.B) {
+	data := make([]TestCategory, 10000)
+	for i := range data {
+		data[i] = TestCategory{
+			ID:       i + 1,
+			ParentID: i / 10, // 10 children per node
+			Title:    fmt.Sprintf("Node %d", len(data)-i),
+		}
+	}
+	sortByTitle := WithSort(func(a, b TestCategory) bool { return a.Title < b.Title })
+
+	b.Run("EagerSort", func(b *testing.B) {
+		tree := New[TestCategory]()
+		for i := 0; i < b.N; i++ {
+			_ = tree.Load(data,
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+				sortByTitle,
+			)
+		}
+	})
+
+	b.Run("LazySort", func(b *testing.B) {
+		tree := New[TestCategory]()
+		for i := 0; i < b.N; i++ {
+			_ = tree.Load(data,
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+				sortByTitle,
+				WithLazySort[TestCategory](),
+			)
+		}
+	})
+}
+
+func TestGetBranchTo(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		ancestorID   int
+		descendantID int
+		wantIDs      []int
+		wantOK       bool
+	}{
+		{"Root to deep node", 1, 15, []int{1, 2, 5, 8, 10, 12, 14, 15}, true},
+		{"Mid-level to descendant", 5, 11, []int{5, 8, 10, 11}, true},
+		{"Parent to child", 3, 6, []int{3, 6}, true},
+		{"Same node", 5, 5, []int{5}, true},
+		{"Not a descendant", 3, 7, []int{}, false},
+		{"Reversed direction", 7, 5, []int{}, false},
+		{"Missing ancestor", 999, 7, []int{}, false},
+		{"Missing descendant", 1, 999, []int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch, ok := tree.GetBranchTo(tt.ancestorID, tt.descendantID)
+			if ok != tt.wantOK {
+				t.Fatalf("GetBranchTo(%d, %d) ok = %v, want %v", tt.ancestorID, tt.descendantID, ok, tt.wantOK)
+			}
+			if branch == nil {
+				t.Fatalf("GetBranchTo(%d, %d) = nil, want non-nil", tt.ancestorID, tt.descendantID)
+			}
+
+			ids := make([]int, len(branch))
+			for i, node := range branch {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetBranchTo(%d, %d) = %v, want %v", tt.ancestorID, tt.descendantID, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestLoadMap(t *testing.T) {
+	items := make(map[int]TestCategory)
+	for _, item := range getTestData() {
+		items[item.ID] = item
+	}
+
+	tree := New[TestCategory]()
+	err := tree.LoadMap(items,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("LoadMap() unexpected error: %v", err)
+	}
+
+	expected := New[TestCategory]()
+	err = expected.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if got, want := tree.ExportEnriched(), expected.ExportEnriched(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadMap() built a different tree than Load()")
+	}
+
+	tests := []struct {
+		name    string
+		items   map[int]TestCategory
+		wantErr string
+	}{
+		{
+			name:    "Empty map",
+			items:   map[int]TestCategory{},
+			wantErr: "invalid data: empty data",
+		},
+		{
+			name:    "Non-positive key",
+			items:   map[int]TestCategory{0: {ID: 0, ParentID: 0}},
+			wantErr: "invalid data: key 0: ID must be positive",
+		},
+		{
+			name:    "Key mismatch",
+			items:   map[int]TestCategory{1: {ID: 2, ParentID: 0}},
+			wantErr: "invalid data: key 1: item has ID 2",
+		},
+		{
+			name:    "Negative parent ID",
+			items:   map[int]TestCategory{1: {ID: 1, ParentID: -1}},
+			wantErr: "invalid data: key 1: parent ID cannot be negative",
+		},
+		{
+			name:    "Invalid parent reference",
+			items:   map[int]TestCategory{1: {ID: 1, ParentID: 2}},
+			wantErr: "invalid parent ID 2 for node 1",
+		},
+		{
+			name:    "Self reference",
+			items:   map[int]TestCategory{1: {ID: 1, ParentID: 1}},
+			wantErr: "node 1: node is its own parent",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New[TestCategory]().LoadMap(tt.items,
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+			)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("LoadMap() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	err = New[TestCategory]().LoadMap(items,
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err == nil || err.Error() != "id function is required" {
+		t.Errorf("LoadMap() error = %v, want %q", err, "id function is required")
+	}
+}
+
+func TestGetTopChildren(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		n        int
+		wantIDs  []int
+		wantMore bool
+	}{
+		{"Truncated", 2, 2, []int{4, 5}, true},
+		{"Exact count", 2, 3, []int{4, 5, 17}, false},
+		{"Larger than count", 2, 10, []int{4, 5, 17}, false},
+		{"Zero", 2, 0, []int{}, true},
+		{"Negative", 2, -1, []int{}, true},
+		{"Leaf node", 4, 5, []int{}, false},
+		{"Missing node", 999, 5, []int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children, more := tree.GetTopChildren(tt.id, tt.n)
+			ids := make([]int, len(children))
+			for i, child := range children {
+				ids[i] = child.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || more != tt.wantMore {
+				t.Errorf("GetTopChildren(%d, %d) = %v, %v, want %v, %v",
+					tt.id, tt.n, ids, more, tt.wantIDs, tt.wantMore)
+			}
+		})
+	}
+
+	// The result is a copy
+	children, _ := tree.GetTopChildren(2, 2)
+	children[0] = children[1]
+	if ids := tree.GetChildrenIDs(2); !reflect.DeepEqual(ids, []int{4, 5, 17}) {
+		t.Errorf("GetChildrenIDs(2) = %v after modifying result, want [4 5 17]", ids)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	tree.SetMeta(17, "expanded", true)
+
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Title"
+	before := tree.FormatTreeDisplay(1, opt)
+	oldNode, _ := tree.FindNode(17)
+
+	mapping := tree.Reindex(nil)
+	if len(mapping) != len(getTestData()) {
+		t.Fatalf("Reindex() mapping has %d entries, want %d", len(mapping), len(getTestData()))
+	}
+
+	// New IDs are contiguous and assigned in depth-first order
+	wantOrder := []int{1, 2, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 3, 6}
+	for i, oldID := range wantOrder {
+		if mapping[oldID] != i+1 {
+			t.Errorf("Reindex() mapped %d to %d, want %d", oldID, mapping[oldID], i+1)
+		}
+	}
+
+	// Structure and order are preserved
+	after := tree.FormatTreeDisplay(1, opt)
+	if len(after) != len(before) {
+		t.Fatalf("FormatTreeDisplay() got %d nodes after reindex, want %d", len(after), len(before))
+	}
+	for i := range before {
+		if after[i].DisplayName != before[i].DisplayName || after[i].ID != mapping[before[i].ID] {
+			t.Errorf("row %d = {%d %q}, want {%d %q}", i,
+				after[i].ID, after[i].DisplayName, mapping[before[i].ID], before[i].DisplayName)
+		}
+	}
+	for oldID, newID := range mapping {
+		node, exists := tree.FindNode(newID)
+		if !exists {
+			t.Errorf("node %d (old %d) not found after reindex", newID, oldID)
+			continue
+		}
+		if node.Data.ID != oldID {
+			t.Errorf("node %d data ID = %d, want untouched %d", newID, node.Data.ID, oldID)
+		}
+		if node.ParentID != mapping[node.Data.ParentID] {
+			t.Errorf("node %d parent = %d, want %d", newID, node.ParentID, mapping[node.Data.ParentID])
+		}
+	}
+
+	// Metadata follows the node, previously obtained nodes are unchanged
+	if value, ok := tree.GetMeta(mapping[17], "expanded"); !ok || value != true {
+		t.Errorf("GetMeta(%d, expanded) = %v, %v, want true, true", mapping[17], value, ok)
+	}
+	if oldNode.ID != 17 {
+		t.Errorf("previously obtained node ID changed to %d", oldNode.ID)
+	}
+
+	if got := New[TestCategory]().Reindex(nil); len(got) != 0 {
+		t.Errorf("Reindex() on empty tree = %v, want empty mapping", got)
+	}
+
+	// Without relabel the data keeps the old IDs, so it can't be updated
+	if err := tree.UpdateNodeData(mapping[17], oldNode.Data); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("UpdateNodeData() after Reindex(nil) error = %v, want %v", err, ErrInvalidID)
+	}
+}
+
+func TestReindexRelabel(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	mapping := tree.Reindex(func(c TestCategory, id, parentID int) TestCategory {
+		c.ID, c.ParentID = id, parentID
+		return c
+	})
+	for oldID, newID := range mapping {
+		node, _ := tree.FindNode(newID)
+		if node.Data.ID != newID || node.Data.ParentID != node.ParentID {
+			t.Errorf("node %d (old %d) data IDs = %d, %d, want %d, %d",
+				newID, oldID, node.Data.ID, node.Data.ParentID, newID, node.ParentID)
+		}
+	}
+
+	// The relabeled data passes the ID check of UpdateNodeData
+	node, _ := tree.FindNode(mapping[17])
+	data := node.Data
+	data.Title = "Renamed"
+	if err := tree.UpdateNodeData(node.ID, data); err != nil {
+		t.Fatalf("UpdateNodeData() after Reindex error = %v", err)
+	}
+	if updated, _ := tree.FindNode(node.ID); updated.Data.Title != "Renamed" {
+		t.Errorf("UpdateNodeData() title = %q, want %q", updated.Data.Title, "Renamed")
+	}
+}
+
+func TestGetSiblingsSplit(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	ids := func(nodes []*Node[TestCategory]) []int {
+		result := make([]int, len(nodes))
+		for i, node := range nodes {
+			result[i] = node.ID
+		}
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		id         int
+		wantBefore []int
+		wantAfter  []int
+		wantOK     bool
+	}{
+		{"First sibling", 4, []int{}, []int{5, 17}, true},
+		{"Middle sibling", 5, []int{4}, []int{17}, true},
+		{"Last sibling", 17, []int{4, 5}, []int{}, true},
+		{"Only child", 6, []int{}, []int{}, true},
+		{"Root node", 1, []int{}, []int{}, true},
+		{"Missing node", 999, []int{}, []int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, ok := tree.GetSiblingsSplit(tt.id)
+			if ok != tt.wantOK {
+				t.Fatalf("GetSiblingsSplit(%d) ok = %v, want %v", tt.id, ok, tt.wantOK)
+			}
+			if before == nil || after == nil {
+				t.Fatalf("GetSiblingsSplit(%d) = %v, %v, want non-nil slices", tt.id, before, after)
+			}
+			if !reflect.DeepEqual(ids(before), tt.wantBefore) || !reflect.DeepEqual(ids(after), tt.wantAfter) {
+				t.Errorf("GetSiblingsSplit(%d) = %v, %v, want %v, %v",
+					tt.id, ids(before), ids(after), tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestFormatTreeDisplayNonStringField(t *testing.T) {
+	tree := New[TestCategory]()
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root", Sort: 10},
+		{ID: 2, ParentID: 1, Title: "Child 1", Sort: 20},
+		{ID: 3, ParentID: 1, Title: "Child 2", Sort: 30},
+	}
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Sort"
+	formatted := tree.FormatTreeDisplay(1, opt)
+
+	want := []string{"10", " ├ 20", " └ 30"}
+	got := make([]string, len(formatted))
+	for i, node := range formatted {
+		got[i] = node.DisplayName
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FormatTreeDisplay() = %q, want %q", got, want)
+	}
+}
+
+func TestGetDescendantsBudget(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	unit := func(TestCategory) int { return 1 }
+	// Nodes with a deeper title cost more
+	byLevel := func(c TestCategory) int { return strings.Count(c.Title, ".") + 1 }
+
+	tests := []struct {
+		name    string
+		id      int
+		cost    func(TestCategory) int
+		budget  int
+		wantIDs []int
+	}{
+		{"Unit cost", 1, unit, 4, []int{2, 4, 5, 7}},
+		{"Whole subtree fits", 3, unit, 10, []int{6}},
+		{"Zero budget", 1, unit, 0, []int{}},
+		{"Overflowing node stops traversal", 2, byLevel, 5, []int{4, 5}},
+		{"Exact fit", 2, byLevel, 7, []int{4, 5, 7}},
+		{"Leaf node", 4, unit, 10, []int{}},
+		{"Missing node", 999, unit, 10, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.GetDescendantsBudget(tt.id, tt.cost, tt.budget)
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetDescendantsBudget(%d, %d) = %v, want %v", tt.id, tt.budget, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestCanMove(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		id          int
+		newParentID int
+		wantErr     string
+	}{
+		{"Move to another branch", 5, 3, ""},
+		{"Move to current parent", 5, 2, ""},
+		{"Move to root level", 5, 0, ""},
+		{"Move under leaf of sibling branch", 3, 17, ""},
+		{"Missing node", 999, 1, "node 999 not found"},
+		{"Missing parent", 5, 999, "parent node 999 not found"},
+		{"Under itself", 5, 5, "cannot move node 5 under itself"},
+		{"Under direct child", 5, 8, "cannot move node 5 under its descendant 8"},
+		{"Under deep descendant", 2, 15, "cannot move node 2 under its descendant 15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tree.CanMove(tt.id, tt.newParentID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CanMove(%d, %d) unexpected error: %v", tt.id, tt.newParentID, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("CanMove(%d, %d) error = %v, want %q", tt.id, tt.newParentID, err, tt.wantErr)
+			}
+		})
+	}
+
+	// The tree must not be modified
+	if parentID, _ := tree.GetParentID(5); parentID != 2 {
+		t.Errorf("node 5 parent = %d after CanMove, want 2", parentID)
+	}
+}
+
+func TestGetAncestorsRootFirst(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		nodeID      int
+		includeSelf bool
+	}{
+		{"Deep node with self", 15, true},
+		{"Deep node without self", 15, false},
+		{"Root node with self", 1, true},
+		{"Root node without self", 1, false},
+		{"Non-existent node", 999, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ancestors := tree.GetAncestorsRootFirst(tt.nodeID, tt.includeSelf)
+			ids := make([]int, len(ancestors))
+			for i, node := range ancestors {
+				ids[i] = node.ID
+			}
+
+			// Must match the ID path from GetNodePath
+			want := tree.GetNodePath(tt.nodeID, tt.includeSelf)
+			if !reflect.DeepEqual(ids, want) {
+				t.Errorf("GetAncestorsRootFirst(%d, %v) = %v, want %v", tt.nodeID, tt.includeSelf, ids, want)
+			}
+		})
+	}
+}
+
+func TestMissingIDs(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ids  []int
+		want []int
+	}{
+		{"All present", []int{1, 5, 17}, []int{}},
+		{"Preserves input order", []int{99, 1, 0, 5, -3, 42}, []int{99, 0, -3, 42}},
+		{"Empty input", nil, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.MissingIDs(tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MissingIDs(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDescendantsIDSet(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		maxDepth int
+	}{
+		{"Unlimited depth", 1, 0},
+		{"Limited depth", 1, 3},
+		{"One level", 2, 1},
+		{"Leaf node", 4, 0},
+		{"Missing node", 999, 0},
+		{"Negative depth", 1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := tree.GetDescendantsIDSet(tt.id, tt.maxDepth)
+			ids := tree.GetDescendantsIDs(tt.id, tt.maxDepth)
+			if set == nil || len(set) != len(ids) {
+				t.Fatalf("GetDescendantsIDSet(%d, %d) = %v, want the %d IDs %v", tt.id, tt.maxDepth, set, len(ids), ids)
+			}
+			for _, id := range ids {
+				if !set[id] {
+					t.Errorf("GetDescendantsIDSet(%d, %d) is missing %d", tt.id, tt.maxDepth, id)
+				}
+			}
+		})
+	}
+}
+
+func TestInputOrderTiebreak(t *testing.T) {
+	// Many siblings share the same sort key, in a shuffled ID order
+	data := []TestCategory{{ID: 1, ParentID: 0, Title: "Root"}}
+	for i, id := range []int{40, 3, 27, 15, 8, 33, 21, 2, 38, 11, 19, 30, 5, 25, 13, 36} {
+		data = append(data, TestCategory{ID: id, ParentID: 1, Title: "Child", Sort: i % 2})
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Sort < b.Sort }),
+		WithInputOrderTiebreak[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	// Equal siblings keep their input order within each sort key
+	want := []int{40, 27, 8, 21, 38, 19, 5, 13, 3, 15, 33, 2, 11, 30, 25, 36}
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(1) = %v, want %v", got, want)
+	}
+
+	// Lazy sorting gives the same order
+	err = tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Sort < b.Sort }),
+		WithInputOrderTiebreak[TestCategory](),
+		WithLazySort[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(1) with lazy sort = %v, want %v", got, want)
+	}
+}
+
+func TestMapTree(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Title > b.Title }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	type dto struct {
+		Name string
+	}
+	mapped := MapTree(tree, func(c TestCategory) dto {
+		return dto{Name: strings.ToUpper(c.Title)}
+	})
+
+	// Same structure and order, transformed data
+	original := tree.ExportEnriched()
+	projected := mapped.ExportEnriched()
+	if len(projected) != len(original) {
+		t.Fatalf("MapTree() has %d nodes, want %d", len(projected), len(original))
+	}
+	for i := range original {
+		if projected[i].ID != original[i].ID ||
+			projected[i].ParentID != original[i].ParentID ||
+			!reflect.DeepEqual(projected[i].Path, original[i].Path) {
+			t.Errorf("row %d = %+v, want structure of %+v", i, projected[i], original[i])
+		}
+		if want := strings.ToUpper(original[i].Data.Title); projected[i].Data.Name != want {
+			t.Errorf("node %d data = %q, want %q", projected[i].ID, projected[i].Data.Name, want)
+		}
+	}
+
+	// The projected tree is independent from the original
+	node, _ := mapped.FindNode(2)
+	node.Data.Name = "changed"
+	if original, _ := tree.FindNode(2); original.Data.Title != "Child 1" {
+		t.Errorf("original node 2 title = %q, want unchanged", original.Data.Title)
+	}
+
+	if got := MapTree(New[TestCategory](), func(c TestCategory) dto { return dto{} }); len(got.nodes) != 0 {
+		t.Errorf("MapTree() of empty tree has %d nodes, want 0", len(got.nodes))
+	}
+}
+
+func TestHasMoreBelow(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		want bool
+	}{
+		{"Root node", 1, true},
+		{"Inner node", 5, true},
+		{"Leaf node", 4, false},
+		{"Missing node", 999, false},
+		{"Root sentinel", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.HasMoreBelow(tt.id); got != tt.want {
+				t.Errorf("HasMoreBelow(%d) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+
+	// Nodes cut off by maxDepth still report their children
+	for _, node := range tree.GetDescendants(1, 2) {
+		want := len(tree.GetChildren(node.ID)) > 0
+		if got := tree.HasMoreBelow(node.ID); got != want {
+			t.Errorf("HasMoreBelow(%d) = %v, want %v", node.ID, got, want)
+		}
+	}
+}
+
+func TestGetChildrenSorted(t *testing.T) {
+	tree := New[TestCategory]()
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root"},
+		{ID: 2, ParentID: 1, Title: "B", Sort: 2},
+		{ID: 3, ParentID: 1, Title: "C", Sort: 1},
+		{ID: 4, ParentID: 1, Title: "A", Sort: 2},
+	}
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	ids := func(nodes []*Node[TestCategory]) []int {
+		result := make([]int, len(nodes))
+		for i, node := range nodes {
+			result[i] = node.ID
+		}
+		return result
+	}
+
+	byTitle := tree.GetChildrenSorted(1, func(a, b TestCategory) bool { return a.Title < b.Title })
+	if got := ids(byTitle); !reflect.DeepEqual(got, []int{4, 2, 3}) {
+		t.Errorf("GetChildrenSorted(1, byTitle) = %v, want [4 2 3]", got)
+	}
+
+	// Ties keep the stored (ID) order
+	bySort := tree.GetChildrenSorted(1, func(a, b TestCategory) bool { return a.Sort < b.Sort })
+	if got := ids(bySort); !reflect.DeepEqual(got, []int{3, 2, 4}) {
+		t.Errorf("GetChildrenSorted(1, bySort) = %v, want [3 2 4]", got)
+	}
+
+	// The stored order is unchanged
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("GetChildrenIDs(1) = %v, want [2 3 4]", got)
+	}
+
+	if got := tree.GetChildrenSorted(3, func(a, b TestCategory) bool { return a.Title < b.Title }); len(got) != 0 {
+		t.Errorf("GetChildrenSorted(3) = %v, want empty", ids(got))
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tree := New[TestCategory]()
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "electronics"},
+		{ID: 2, ParentID: 1, Title: "phones"},
+		{ID: 3, ParentID: 1, Title: "tablets"},
+		{ID: 4, ParentID: 2, Title: "android"},
+		{ID: 5, ParentID: 2, Title: "ios"},
+		{ID: 6, ParentID: 3, Title: "android"},
+		{ID: 7, ParentID: 0, Title: "books"},
+		{ID: 8, ParentID: 7, Title: "android"},
+		{ID: 9, ParentID: 4, Title: "android"},
+	}
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	label := func(c TestCategory) string { return c.Title }
+
+	tests := []struct {
+		name    string
+		pattern string
+		wantIDs []int
+	}{
+		{"Exact path", "electronics/phones/android", []int{4}},
+		{"Single-level wildcard", "electronics/*/android", []int{4, 6}},
+		{"Wildcard root", "*/android", []int{8}},
+		{"All roots", "*", []int{1, 7}},
+		{"Wildcards only", "*/*/*", []int{4, 5, 6}},
+		{"Surrounding slashes", "/electronics/tablets/", []int{3}},
+		{"No match", "electronics/laptops", []int{}},
+		{"Too deep", "electronics/phones/android/android/android", []int{}},
+		{"Recursive wildcard unsupported", "**/android", []int{}},
+		{"Empty pattern", "", []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.Glob(tt.pattern, label)
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Glob(%q) = %v, want %v", tt.pattern, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetSiblingsReturnsCopy(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	for _, includeSelf := range []bool{true, false} {
+		siblings := tree.GetSiblings(4, includeSelf)
+		sort.Slice(siblings, func(i, j int) bool {
+			return siblings[i].ID > siblings[j].ID
+		})
+
+		if got := tree.GetChildrenIDs(2); !reflect.DeepEqual(got, []int{4, 5, 17}) {
+			t.Errorf("GetChildrenIDs(2) = %v after sorting GetSiblings(4, %v), want [4 5 17]",
+				got, includeSelf)
+		}
+	}
+}
+
+func TestAggregateSubtrees(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	value := func(c TestCategory) float64 { return float64(c.ID) }
+	sums := tree.AggregateSubtrees(value)
+	if len(sums) != len(getTestData()) {
+		t.Fatalf("AggregateSubtrees() has %d entries, want %d", len(sums), len(getTestData()))
+	}
+
+	// Compare with the per-node computation
+	for _, item := range getTestData() {
+		want := float64(item.ID)
+		for _, node := range tree.GetDescendants(item.ID, 0) {
+			want += value(node.Data)
+		}
+		if sums[item.ID] != want {
+			t.Errorf("AggregateSubtrees()[%d] = %v, want %v", item.ID, sums[item.ID], want)
+		}
+	}
+
+	if sums[1] != 153 { // 1 + 2 + ... + 17
+		t.Errorf("AggregateSubtrees()[1] = %v, want 153", sums[1])
+	}
+	if sums[4] != 4 {
+		t.Errorf("AggregateSubtrees()[4] = %v, want 4 for a leaf", sums[4])
+	}
+}
+
+type internedProduct struct {
+	ID       int
+	ParentID int
+	Category string
+	Price    int
+}
+
+func TestWithStringInterning(t *testing.T) {
+	// Build each category string separately so they start with distinct backing storage
+	data := make([]internedProduct, 6)
+	for i := range data {
+		data[i] = internedProduct{ID: i + 1, Category: fmt.Sprintf("cat-%d", i%2)}
+	}
+
+	tree := New[internedProduct]()
+	err := tree.Load(data,
+		WithIDFunc(func(p internedProduct) int { return p.ID }),
+		WithParentIDFunc(func(p internedProduct) int { return p.ParentID }),
+		WithStringInterning[internedProduct]("Category"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	for _, pair := range [][2]int{{1, 3}, {1, 5}, {2, 4}, {2, 6}} {
+		a, _ := tree.FindNode(pair[0])
+		b, _ := tree.FindNode(pair[1])
+		if a.Data.Category != b.Data.Category {
+			t.Fatalf("Category of %d and %d differ: %q vs %q", pair[0], pair[1], a.Data.Category, b.Data.Category)
+		}
+		if unsafe.StringData(a.Data.Category) != unsafe.StringData(b.Data.Category) {
+			t.Errorf("Category of %d and %d not interned", pair[0], pair[1])
+		}
+	}
+
+	// The input slice is left untouched
+	if unsafe.StringData(data[0].Category) == unsafe.StringData(data[2].Category) {
+		t.Error("Input data should not be modified")
+	}
+
+	invalid := []struct {
+		name   string
+		fields []string
+	}{
+		{"missing field", []string{"Name"}},
+		{"non-string field", []string{"Price"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New[internedProduct]().Load(data,
+				WithIDFunc(func(p internedProduct) int { return p.ID }),
+				WithParentIDFunc(func(p internedProduct) int { return p.ParentID }),
+				WithStringInterning[internedProduct](tt.fields...),
+			)
+			if err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	t.Run("non-struct type", func(t *testing.T) {
+		err := New[int]().Load([]int{1},
+			WithIDFunc(func(v int) int { return v }),
+			WithParentIDFunc(func(v int) int { return 0 }),
+			WithStringInterning[int]("Category"),
+		)
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func BenchmarkStringInterning(b *testing.B) {
+	// A product catalog where many nodes share a handful of category names
+	categories := []string{"Electronics", "Home & Kitchen", "Books", "Clothing", "Sports & Outdoors"}
+	newData := func() []internedProduct {
+		data := make([]internedProduct, 100000)
+		for i := range data {
+			data[i] = internedProduct{
+				ID:       i + 1,
+				ParentID: i / 10,
+				Category: strings.Clone(categories[i%len(categories)] + " / Department"),
+			}
+		}
+		return data
+	}
+
+	run := func(b *testing.B, opts ...LoadOption[internedProduct]) {
+		opts = append(opts,
+			WithIDFunc(func(p internedProduct) int { return p.ID }),
+			WithParentIDFunc(func(p internedProduct) int { return p.ParentID }),
+		)
+		var retained uint64
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			data := newData()
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			b.StartTimer()
+
+			tree := New[internedProduct]()
+			_ = tree.Load(data, opts...)
+
+			b.StopTimer()
+			data = nil // only the tree's copies stay reachable
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			retained += after.HeapAlloc - min(after.HeapAlloc, before.HeapAlloc)
+			runtime.KeepAlive(tree)
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(retained)/float64(b.N), "heap-B/op")
+	}
+
+	b.Run("Plain", func(b *testing.B) { run(b) })
+	b.Run("Interned", func(b *testing.B) {
+		run(b, WithStringInterning[internedProduct]("Category"))
+	})
+}
+
+func TestGetChildrenIDSet(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+	}{
+		{"Root node", 1},
+		{"Inner node", 2},
+		{"Leaf node", 4},
+		{"Missing node", 999},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := tree.GetChildrenIDSet(tt.id)
+			ids := tree.GetChildrenIDs(tt.id)
+			if set == nil || len(set) != len(ids) {
+				t.Fatalf("GetChildrenIDSet(%d) = %v, want the %d IDs %v", tt.id, set, len(ids), ids)
+			}
+			for _, id := range ids {
+				if !set[id] {
+					t.Errorf("GetChildrenIDSet(%d) is missing %d", tt.id, id)
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllAndDirectDescendants(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	for _, id := range []int{1, 2, 4, 999} {
+		if got, want := tree.GetAllDescendants(id), tree.GetDescendants(id, 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetAllDescendants(%d) = %v, want %v", id, got, want)
+		}
+		if got, want := tree.GetDirectDescendants(id), tree.GetChildren(id); len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("GetDirectDescendants(%d) = %v, want %v", id, got, want)
+		}
+	}
+
+	if got := tree.GetDescendants(1, DepthNone); got == nil || len(got) != 0 {
+		t.Errorf("GetDescendants(1, DepthNone) = %v, want empty", got)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root A"},
+		{ID: 2, ParentID: 1, Title: "Child 1"},
+		{ID: 3, ParentID: 1, Title: "Child 2"},
+		{ID: 4, ParentID: 2, Title: "Child 1.1"},
+		{ID: 5, ParentID: 0, Title: "Root B"},
+		{ID: 6, ParentID: 5, Title: "Child B1"},
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	want := [][2]int{{1, 2}, {2, 4}, {1, 3}, {5, 6}}
+	if got := tree.Edges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Edges() = %v, want %v", got, want)
+	}
+
+	if got := New[TestCategory]().Edges(); len(got) != 0 {
+		t.Errorf("Edges() on empty tree = %v, want empty", got)
+	}
+}
+
+func TestFormatTreeDisplayCollapsed(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Title"
+
+	tests := []struct {
+		name      string
+		rootID    int
+		collapsed map[int]bool
+		expected  []string
+	}{
+		{
+			name:      "Collapsed inner nodes",
+			rootID:    1,
+			collapsed: map[int]bool{5: true, 3: true},
+			expected: []string{
+				"Root",
+				" ├ Child 1",
+				" │ ├ Child 1.1",
+				" │ ├ Child 1.2",
+				" │ └ Child 1.3",
+				" └ Child 2",
+			},
+		},
+		{
+			name:      "Collapsed deep node",
+			rootID:    8,
+			collapsed: map[int]bool{10: true},
+			expected: []string{
+				"Child 1.2.2",
+				" ├ Child 1.2.2.1",
+				" └ Child 1.2.2.2",
+			},
+		},
+		{
+			name:      "Collapsed root",
+			rootID:    1,
+			collapsed: map[int]bool{1: true},
+			expected:  []string{"Root"},
+		},
+		{
+			name:      "Collapsed leaf",
+			rootID:    3,
+			collapsed: map[int]bool{6: true},
+			expected:  []string{"Child 2", " └ Child 2.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted := tree.FormatTreeDisplayCollapsed(tt.rootID, tt.collapsed, opt)
+			got := make([]string, len(formatted))
+			for i, node := range formatted {
+				got[i] = node.DisplayName
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("FormatTreeDisplayCollapsed() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	// No collapsed nodes renders the full tree
+	if got, want := tree.FormatTreeDisplayCollapsed(1, nil, opt), tree.FormatTreeDisplay(1, opt); !reflect.DeepEqual(got, want) {
+		t.Errorf("FormatTreeDisplayCollapsed() with nil collapsed = %v, want %v", got, want)
+	}
+}
+
+func TestWithAfterLoad(t *testing.T) {
+	tree := New[TestCategory]()
+
+	var calls int
+	var childCount int
+	hook := WithAfterLoad(func(tr *Tree[TestCategory]) {
+		calls++
+		// The hook can query the tree, even with lazily sorted children
+		childCount = len(tr.GetChildren(1))
+	})
+
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithLazySort[TestCategory](),
+		hook,
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if calls != 1 || childCount != 2 {
+		t.Errorf("After Load: calls = %d, childCount = %d, want 1 and 2", calls, childCount)
+	}
+
+	items := map[int]TestCategory{
+		1: {ID: 1, ParentID: 0, Title: "Root"},
+		2: {ID: 2, ParentID: 1, Title: "Child"},
+	}
+	err = tree.LoadMap(items,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		hook,
+	)
+	if err != nil {
+		t.Fatalf("Failed to load map data: %v", err)
+	}
+	if calls != 2 || childCount != 1 {
+		t.Errorf("After LoadMap: calls = %d, childCount = %d, want 2 and 1", calls, childCount)
+	}
+
+	// A failed load doesn't invoke the hook
+	err = tree.Load([]TestCategory{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 1}},
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		hook,
+	)
+	if err == nil {
+		t.Fatal("Expected error for circular reference, got nil")
+	}
+	if calls != 2 {
+		t.Errorf("Hook called %d times after failed load, want 2", calls)
+	}
+}
+
+func TestChildrenMap(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	children := tree.ChildrenMap()
+	if len(children[0]) != 1 || children[0][0].ID != 1 {
+		t.Errorf("ChildrenMap()[0] = %v, want the root node", children[0])
+	}
+	for _, id := range []int{1, 2, 5, 8} {
+		if !reflect.DeepEqual(children[id], tree.GetChildren(id)) {
+			t.Errorf("ChildrenMap()[%d] = %v, want %v", id, children[id], tree.GetChildren(id))
+		}
+	}
+	if _, exists := children[4]; exists {
+		t.Error("ChildrenMap() should not contain leaf nodes")
+	}
+
+	// Modifying the snapshot doesn't affect the tree
+	children[1][0] = nil
+	delete(children, 2)
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("GetChildrenIDs(1) = %v after modifying snapshot, want [2 3]", got)
+	}
+	if got := tree.GetChildrenIDs(2); !reflect.DeepEqual(got, []int{4, 5, 17}) {
+		t.Errorf("GetChildrenIDs(2) = %v after modifying snapshot, want [4 5 17]", got)
+	}
+}
+
+func TestRelationship(t *testing.T) {
+	data := append(getTestData(), TestCategory{ID: 20, ParentID: 0, Title: "Other root"})
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		a, b int
+		want Relation
+	}{
+		{"Self", 5, 5, RelationSelf},
+		{"Parent", 2, 5, RelationAncestor},
+		{"Distant ancestor", 1, 16, RelationAncestor},
+		{"Child", 5, 2, RelationDescendant},
+		{"Distant descendant", 16, 1, RelationDescendant},
+		{"Siblings", 4, 17, RelationSibling},
+		{"Root siblings", 1, 20, RelationSibling},
+		{"Cousins", 4, 6, RelationUnrelated},
+		{"Different trees", 20, 6, RelationUnrelated},
+		{"Missing node", 1, 999, RelationUnrelated},
+		{"Missing self", 999, 999, RelationUnrelated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.Relationship(tt.a, tt.b); got != tt.want {
+				t.Errorf("Relationship(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+
+	if got := RelationAncestor.String(); got != "ancestor" {
+		t.Errorf("RelationAncestor.String() = %q, want %q", got, "ancestor")
+	}
+}
+
+func TestWithMaxNodes(t *testing.T) {
+	data := getTestData() // 17 nodes
+
+	tests := []struct {
+		name     string
+		maxNodes int
+		wantErr  bool
+	}{
+		{"Unlimited", 0, false},
+		{"Negative means unlimited", -1, false},
+		{"Exact limit", 17, false},
+		{"Over limit", 16, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := New[TestCategory]()
+			err := tree.Load(data,
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+				WithMaxNodes[TestCategory](tt.maxNodes),
+			)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	items := map[int]TestCategory{
+		1: {ID: 1, ParentID: 0},
+		2: {ID: 2, ParentID: 1},
+		3: {ID: 3, ParentID: 1},
+	}
+	err := New[TestCategory]().LoadMap(items,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithMaxNodes[TestCategory](2),
+	)
+	want := "too many nodes: 3 exceeds the limit of 2"
+	if err == nil || err.Error() != want {
+		t.Errorf("LoadMap() error = %v, want %q", err, want)
+	}
+}
+
+func TestGetDescendantsWithDepth(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		maxDepth int
+		expected [][2]int // {ID, Depth}
+	}{
+		{"Two levels", 2, 2, [][2]int{{4, 1}, {5, 1}, {17, 1}, {7, 2}, {8, 2}}},
+		{"Unlimited depth", 8, 0, [][2]int{{9, 1}, {10, 1}, {11, 2}, {12, 2}, {13, 3}, {14, 3}, {15, 4}, {16, 4}}},
+		{"Leaf node", 4, 0, nil},
+		{"Missing node", 999, 0, nil},
+		{"Negative depth", 1, -1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tree.GetDescendantsWithDepth(tt.id, tt.maxDepth)
+			var got [][2]int
+			for _, d := range result {
+				got = append(got, [2]int{d.Node.ID, d.Depth})
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("GetDescendantsWithDepth(%d, %d) = %v, want %v", tt.id, tt.maxDepth, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRemoveChildren(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	tree.SetMeta(9, "expanded", true)
+
+	// Node 8 has 8 descendants: 9 to 16
+	if removed := tree.RemoveChildren(8); removed != 8 {
+		t.Errorf("RemoveChildren(8) = %d, want 8", removed)
+	}
+	if _, exists := tree.FindNode(8); !exists {
+		t.Error("RemoveChildren(8) should keep node 8")
+	}
+	for id := 9; id <= 16; id++ {
+		if _, exists := tree.FindNode(id); exists {
+			t.Errorf("Node %d should have been removed", id)
+		}
+	}
+	if children := tree.GetChildren(8); len(children) != 0 {
+		t.Errorf("GetChildren(8) = %v, want empty", children)
+	}
+	if _, exists := tree.GetMeta(9, "expanded"); exists {
+		t.Error("Metadata of removed node 9 should be dropped")
+	}
+
+	// The rest of the tree is untouched
+	if got := tree.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, []int{2, 3, 4, 5, 17, 7, 8, 6}) {
+		t.Errorf("GetDescendantsIDs(1, 0) = %v after removal", got)
+	}
+
+	if removed := tree.RemoveChildren(4); removed != 0 {
+		t.Errorf("RemoveChildren(4) on leaf = %d, want 0", removed)
+	}
+	if removed := tree.RemoveChildren(999); removed != 0 {
+		t.Errorf("RemoveChildren(999) on missing node = %d, want 0", removed)
+	}
+	if removed := tree.RemoveChildren(0); removed != 0 {
+		t.Errorf("RemoveChildren(0) on the root sentinel = %d, want 0", removed)
+	}
+	if got := tree.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, []int{2, 3, 4, 5, 17, 7, 8, 6}) {
+		t.Errorf("GetDescendantsIDs(1, 0) = %v after RemoveChildren(0) and RemoveChildren(999)", got)
+	}
+}
+
+func TestFormatTreeDisplayMultipleFields(t *testing.T) {
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root", Sort: 10},
+		{ID: 2, ParentID: 1, Title: "Child", Sort: 20},
+	}
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opt      FormatOption
+		expected []string
+	}{
+		{
+			name:     "Custom separator",
+			opt:      FormatOption{DisplayField: "ID", DisplayFields: []string{"Title", "Sort"}, FieldSep: " — "},
+			expected: []string{"Root — 10", " └ Child — 20"},
+		},
+		{
+			name:     "Default separator",
+			opt:      FormatOption{DisplayFields: []string{"ID", "Title"}},
+			expected: []string{"1 Root", " └ 2 Child"},
+		},
+		{
+			name:     "Missing fields are skipped",
+			opt:      FormatOption{DisplayFields: []string{"Title", "Missing"}, FieldSep: "/"},
+			expected: []string{"Root", " └ Child"},
+		},
+		{
+			name:     "No field exists",
+			opt:      FormatOption{DisplayFields: []string{"Missing"}},
+			expected: []string{" └ "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted := tree.FormatTreeDisplay(1, tt.opt)
+			got := make([]string, len(formatted))
+			for i, node := range formatted {
+				got[i] = node.DisplayName
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("FormatTreeDisplay() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindByPath(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	title := func(c TestCategory) string { return c.Title }
+
+	tests := []struct {
+		name         string
+		parts        []string
+		wantID       int
+		wantOK       bool
+		wantChildren []int
+	}{
+		{"Root", []string{"Root"}, 1, true, []int{2, 3}},
+		{"Nested", []string{"Root", "Child 1", "Child 1.2"}, 5, true, []int{7, 8}},
+		{"Leaf", []string{"Root", "Child 2", "Child 2.1"}, 6, true, nil},
+		{"Unknown label", []string{"Root", "Child 3"}, 0, false, nil},
+		{"Skipped level", []string{"Root", "Child 1.1"}, 0, false, nil},
+		{"Empty path", nil, 0, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, ok := tree.FindByPath(tt.parts, title)
+			if ok != tt.wantOK || (ok && node.ID != tt.wantID) {
+				t.Errorf("FindByPath(%q) = %v, %v, want ID %d, %v", tt.parts, node, ok, tt.wantID, tt.wantOK)
+			}
+
+			children, ok := tree.GetChildrenByPath(tt.parts, title)
+			if ok != tt.wantOK {
+				t.Errorf("GetChildrenByPath(%q) ok = %v, want %v", tt.parts, ok, tt.wantOK)
+			}
+			var ids []int
+			for _, child := range children {
+				ids = append(ids, child.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantChildren) {
+				t.Errorf("GetChildrenByPath(%q) = %v, want %v", tt.parts, ids, tt.wantChildren)
+			}
+		})
+	}
+}
+
+func TestEmptyResultsAreNonNil(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	none := func(TestCategory) bool { return false }
+	title := func(c TestCategory) string { return c.Title }
+
+	branch, _ := tree.GetBranchTo(3, 7)
+	before, after, _ := tree.GetSiblingsSplit(999)
+	byPath, _ := tree.GetChildrenByPath([]string{"Missing"}, title)
+	leafByPath, _ := tree.GetChildrenByPath([]string{"Root", "Child 2", "Child 2.1"}, title)
+
+	results := map[string]any{
+		"GetChildren leaf":                 tree.GetChildren(4),
+		"GetChildren missing":              tree.GetChildren(999),
+		"GetChildrenIDs leaf":              tree.GetChildrenIDs(4),
+		"GetChildrenWhere no match":        tree.GetChildrenWhere(1, none),
+		"GetChildrenSorted leaf":           tree.GetChildrenSorted(4, func(a, b TestCategory) bool { return false }),
+		"GetAncestors root":                tree.GetAncestors(1, false),
+		"GetAncestorIDs missing":           tree.GetAncestorIDs(999, true),
+		"GetNodePath missing":              tree.GetNodePath(999, true),
+		"GetBranchTo unrelated":            branch,
+		"GetDescendants leaf":              tree.GetDescendants(4, 0),
+		"GetDescendants negative":          tree.GetDescendants(1, -1),
+		"GetDescendantsIDs leaf":           tree.GetDescendantsIDs(4, 0),
+		"GetDescendantsWithDepth leaf":     tree.GetDescendantsWithDepth(4, 0),
+		"GetDescendantsWithDepth negative": tree.GetDescendantsWithDepth(1, -1),
+		"GetSiblings missing":              tree.GetSiblings(999, true),
+		"GetSiblingsIDs only child":        tree.GetSiblingsIDs(6, false),
+		"GetSiblingsSplit before":          before,
+		"GetSiblingsSplit after":           after,
+		"GetAll no match":                  tree.GetAll(none),
+		"GetChildrenByPath missing":        byPath,
+		"GetChildrenByPath leaf":           leafByPath,
+		"Glob no match":                    tree.Glob("Missing", title),
+		"NodesInDepthRange inverted":       tree.NodesInDepthRange(3, 1),
+		"MissingIDs none missing":          tree.MissingIDs([]int{1}),
+		"FormatTreeDisplay missing":        tree.FormatTreeDisplay(999, DefaultFormatOption()),
+	}
+
+	for name, result := range results {
+		v := reflect.ValueOf(result)
+		if v.IsNil() || v.Len() != 0 {
+			t.Errorf("%s = %#v, want a non-nil empty slice", name, result)
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	tree := New[TestCategory]()
+	// The orphan is rerooted, so the load report is not empty
+	err := tree.Load(append(getTestData(), TestCategory{ID: 50, ParentID: 99}),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.ID > b.ID }),
+		WithLazySort[TestCategory](),
+		WithRepair[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if report := tree.LastLoadReport(); len(report.Rerooted) != 1 {
+		t.Fatalf("LastLoadReport().Rerooted = %v before Clear, want [50]", report.Rerooted)
+	}
+	tree.SetMeta(1, "expanded", true)
+
+	tree.Clear()
+
+	if _, exists := tree.FindNode(1); exists {
+		t.Error("FindNode(1) found a node after Clear")
+	}
+	if roots := tree.GetChildren(0); len(roots) != 0 {
+		t.Errorf("GetChildren(0) = %v after Clear, want empty", roots)
+	}
+	if _, exists := tree.GetMeta(1, "expanded"); exists {
+		t.Error("GetMeta(1) found metadata after Clear")
+	}
+	if edges := tree.Edges(); len(edges) != 0 {
+		t.Errorf("Edges() = %v after Clear, want empty", edges)
+	}
+	if tree.sortFunc == nil {
+		t.Error("Clear should keep the stored sort function")
+	}
+	if stats := tree.LastLoadStats(); stats != (LoadStats{}) {
+		t.Errorf("LastLoadStats() = %+v after Clear, want zero", stats)
+	}
+	if report := tree.LastLoadReport(); len(report.Rerooted) != 0 || len(report.Duplicates) != 0 {
+		t.Errorf("LastLoadReport() = %+v after Clear, want empty", report)
+	}
+
+	// The tree can be loaded again
+	err = tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to reload test data: %v", err)
+	}
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("GetChildrenIDs(1) = %v after reload, want [2 3]", got)
+	}
+}
+
+// buildWideTree returns n nodes below a single root, where every node has up to
+// fanout children.
+func buildWideTree(n, fanout int) []TestCategory {
+	data := make([]TestCategory, n)
+	for i := range data {
+		data[i] = TestCategory{ID: i + 1, ParentID: i / fanout, Title: fmt.Sprintf("Node %d", i+1)}
+	}
+	return data
+}
+
+func TestGetDescendantsParallel(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(buildWideTree(20000, 8),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		maxDepth int
+		workers  int
+	}{
+		{"Unlimited depth", 1, 0, 4},
+		{"Limited depth", 1, 3, 4},
+		{"Children only", 1, 1, 4},
+		{"More workers than children", 2, 0, 32},
+		{"Serial fallback", 1, 0, 1},
+		{"Leaf node", 20000, 0, 4},
+		{"Missing node", 99999, 0, 4},
+		{"Negative depth", 1, -1, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tree.GetDescendantsParallel(tt.id, tt.maxDepth, tt.workers)
+			want := tree.GetDescendants(tt.id, tt.maxDepth)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetDescendantsParallel(%d, %d, %d) returned %d nodes, want the %d nodes of GetDescendants",
+					tt.id, tt.maxDepth, tt.workers, len(got), len(want))
+			}
+		})
+	}
+}
+
+func BenchmarkGetDescendantsParallel(b *testing.B) {
+	tree := New[TestCategory]()
+	err := tree.Load(buildWideTree(500000, 8),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		b.Fatalf("Failed to load test data: %v", err)
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.GetDescendants(1, 0)
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.GetDescendantsParallel(1, 0, runtime.GOMAXPROCS(0))
+		}
+	})
+}
+
+func TestNodesDeeperThan(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		wantIDs  []int
+	}{
+		{"Deep levels", 5, []int{13, 14, 15, 16}},
+		{"Deepest level", 6, []int{15, 16}},
+		{"Beyond tree height", 7, []int{}},
+		{"Below roots", 1, []int{4, 5, 17, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"Negative depth", -1, []int{1, 2, 3, 4, 5, 17, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.NodesDeeperThan(tt.maxDepth)
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("NodesDeeperThan(%d) = %v, want %v", tt.maxDepth, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestWithNaturalSort(t *testing.T) {
+	titles := []string{"10", "file10", "2", "file9", "100", "b", "a2", "a10", "file09", "1", "a"}
+	data := []TestCategory{{ID: 1, ParentID: 0, Title: "Root"}}
+	for i, title := range titles {
+		data = append(data, TestCategory{ID: i + 2, ParentID: 1, Title: title})
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithNaturalSort(func(c TestCategory) string { return c.Title }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	var got []string
+	for _, child := range tree.GetChildren(1) {
+		got = append(got, child.Data.Title)
+	}
+	want := []string{"1", "2", "10", "100", "a", "a2", "a10", "b", "file09", "file9", "file10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildren(1) titles = %q, want %q", got, want)
+	}
+}
+
+func TestWithSortFunc2(t *testing.T) {
+	// Sort holds the explicit order of pinned nodes, 0 means unpinned
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root"},
+		{ID: 2, ParentID: 1, Title: "delta"},
+		{ID: 3, ParentID: 1, Title: "alpha", Sort: 2},
+		{ID: 4, ParentID: 1, Title: "charlie"},
+		{ID: 5, ParentID: 1, Title: "bravo", Sort: 1},
+		{ID: 6, ParentID: 1, Title: "echo", Sort: 2},
+		{ID: 7, ParentID: 1, Title: "alpha"},
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSortFunc2(
+			func(c TestCategory) (bool, int) { return c.Sort != 0, c.Sort },
+			func(a, b TestCategory) bool { return a.Title < b.Title },
+		),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	var got []int
+	for _, child := range tree.GetChildren(1) {
+		got = append(got, child.ID)
+	}
+	// Pinned by order (ties by title), then unpinned by title
+	want := []int{5, 3, 6, 7, 4, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildren(1) IDs = %v, want %v", got, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"2", "10", true},
+		{"10", "2", false},
+		{"x2y", "x10y", true},
+		{"x2y", "x2z", true},
+		{"007", "7", true},
+		{"7", "007", false},
+		{"99999999999999999999", "100000000000000000000", true},
+		{"abc", "abc", false},
+		{"abc", "abcd", true},
+		{"", "a", true},
+		{"a1", "a", false},
+	}
+
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAllLeafCounts(t *testing.T) {
+	data := append(getTestData(), TestCategory{ID: 20, ParentID: 0, Title: "Lonely root"})
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	counts := tree.AllLeafCounts()
+	if len(counts) != len(data) {
+		t.Errorf("AllLeafCounts() has %d entries, want %d", len(counts), len(data))
+	}
+
+	// Leaves: 4, 6, 7, 9, 11, 13, 15, 16, 17 and the lonely root 20
+	tests := map[int]int{1: 9, 2: 8, 3: 1, 5: 6, 8: 5, 10: 4, 12: 3, 14: 2, 4: 1, 16: 1, 20: 1}
+	for id, want := range tests {
+		if got := counts[id]; got != want {
+			t.Errorf("AllLeafCounts()[%d] = %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestLoadSelfParent(t *testing.T) {
+	// Only self-loops, so the error is deterministic regardless of map order
+	data := []TestCategory{
+		{ID: 1, ParentID: 1, Title: "Self"},
+	}
+
+	err := New[TestCategory]().Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if !errors.Is(err, ErrSelfParent) {
+		t.Fatalf("Load() error = %v, want ErrSelfParent", err)
+	}
+	if !strings.Contains(err.Error(), "node 1") {
+		t.Errorf("Load() error = %v, want it to name node 1", err)
+	}
+}
+
+func TestGetChildrenChecked(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		id         int
+		wantIDs    []int
+		wantExists bool
+	}{
+		{"Inner node", 2, []int{4, 5, 17}, true},
+		{"Leaf node", 4, []int{}, true},
+		{"Root level", 0, []int{1}, true},
+		{"Missing node", 999, []int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children, exists := tree.GetChildrenChecked(tt.id)
+			if exists != tt.wantExists {
+				t.Errorf("GetChildrenChecked(%d) exists = %v, want %v", tt.id, exists, tt.wantExists)
+			}
+			ids := make([]int, len(children))
+			for i, child := range children {
+				ids[i] = child.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetChildrenChecked(%d) = %v, want %v", tt.id, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	load := func(data []TestCategory) *Tree[TestCategory] {
+		tree := New[TestCategory]()
+		err := tree.Load(data,
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		return tree
+	}
+	title := func(c TestCategory) []byte { return []byte(c.Title) }
+
+	data := getTestData()
+	base := load(data).Fingerprint(title)
+
+	// Same structure and data in a different input order
+	reversed := slices.Clone(data)
+	slices.Reverse(reversed)
+	if got := load(reversed).Fingerprint(title); got != base {
+		t.Errorf("Fingerprint() = %x for reversed input, want %x", got, base)
+	}
+
+	changes := map[string]func([]TestCategory){
+		"Changed data":   func(d []TestCategory) { d[0].Title = "Renamed" },
+		"Changed parent": func(d []TestCategory) { d[0].ParentID = 3 }, // 17 moves from 2 to 3
+		"Changed ID":     func(d []TestCategory) { d[0].ID = 18 },      // 17 becomes 18, same position
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := slices.Clone(data)
+			change(changed)
+			if got := load(changed).Fingerprint(title); got == base {
+				t.Errorf("Fingerprint() = %x, want a different value", got)
+			}
+		})
+	}
+
+	// Same nodes in a different sibling order
+	descending := New[TestCategory]()
+	err := descending.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.ID > b.ID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if got := descending.Fingerprint(title); got == base {
+		t.Errorf("Fingerprint() = %x for a different sibling order, want a different value", got)
+	}
+}
+
+func TestGetAncestorsUntil(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		id          int
+		stopAtID    int
+		includeSelf bool
+		wantIDs     []int
+	}{
+		{"Stop at grandparent", 7, 2, false, []int{5, 2}},
+		{"Stop at parent with self", 7, 5, true, []int{7, 5}},
+		{"Stop at root", 7, 1, false, []int{5, 2, 1}},
+		{"Stop is the node", 5, 5, true, []int{5}},
+		{"Stop is the node without self", 5, 5, false, []int{}},
+		{"Stop not an ancestor", 7, 3, false, []int{5, 2, 1}},
+		{"Stop is a descendant", 5, 7, true, []int{5, 2, 1}},
+		{"Missing node", 999, 1, true, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.GetAncestorsUntil(tt.id, tt.stopAtID, tt.includeSelf)
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetAncestorsUntil(%d, %d, %v) = %v, want %v", tt.id, tt.stopAtID, tt.includeSelf, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestAllPaths(t *testing.T) {
+	data := append(getTestData(), TestCategory{ID: 20, ParentID: 0, Title: "Other root"})
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	paths := tree.AllPaths()
+	if len(paths) != len(data) {
+		t.Errorf("AllPaths() has %d entries, want %d", len(paths), len(data))
+	}
+	for _, item := range data {
+		if want := tree.GetNodePath(item.ID, true); !reflect.DeepEqual(paths[item.ID], want) {
+			t.Errorf("AllPaths()[%d] = %v, want %v", item.ID, paths[item.ID], want)
+		}
+	}
+
+	// Paths don't share storage
+	paths[2][0] = 999
+	if paths[4][0] != 1 {
+		t.Errorf("Modifying path of node 2 changed path of node 4 to %v", paths[4])
+	}
+}
+
+func TestMoveBeforeAfter(t *testing.T) {
+	load := func(t *testing.T) *Tree[TestCategory] {
+		tree := New[TestCategory]()
+		err := tree.Load(getTestData(),
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+			WithLazySort[TestCategory](),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		return tree
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		targetID int
+		after    bool
+		wantErr  string
+		parentID int   // Parent whose children are checked
+		wantIDs  []int // Expected children of parentID
+	}{
+		{"Before first sibling", 17, 4, false, "", 2, []int{17, 4, 5}},
+		{"After last sibling", 4, 17, true, "", 2, []int{5, 17, 4}},
+		{"After middle sibling", 4, 5, true, "", 2, []int{5, 4, 17}},
+		{"Reparent before", 6, 5, false, "", 2, []int{4, 6, 5, 17}},
+		{"Reparent after", 6, 17, true, "", 2, []int{4, 5, 17, 6}},
+		{"Next to a root", 6, 1, true, "", 0, []int{1, 6}},
+		{"Missing node", 999, 4, false, "node 999 not found", 2, []int{4, 5, 17}},
+		{"Missing target", 4, 999, false, "target node 999 not found", 2, []int{4, 5, 17}},
+		{"Next to itself", 4, 4, true, "cannot move node 4 next to itself", 2, []int{4, 5, 17}},
+		{"Next to own child", 5, 7, false, "cannot move node 5 under itself", 2, []int{4, 5, 17}},
+		{"Next to descendant", 2, 9, true, "cannot move node 2 under its descendant 8", 2, []int{4, 5, 17}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := load(t)
+			before := tree.GetChildren(2)
+
+			var err error
+			if tt.after {
+				err = tree.MoveAfter(tt.id, tt.targetID)
+			} else {
+				err = tree.MoveBefore(tt.id, tt.targetID)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("move error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("move error = %v", err)
+			}
+
+			if got := tree.GetChildrenIDs(tt.parentID); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("GetChildrenIDs(%d) = %v, want %v", tt.parentID, got, tt.wantIDs)
+			}
+			if node, exists := tree.FindNode(tt.id); exists && err == nil && node.ParentID != tt.parentID {
+				t.Errorf("node %d ParentID = %d, want %d", tt.id, node.ParentID, tt.parentID)
+			}
+
+			// Previously returned slices are not modified
+			ids := make([]int, len(before))
+			for i, node := range before {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, []int{4, 5, 17}) {
+				t.Errorf("slice returned before the move changed to %v", ids)
+			}
+		})
+	}
+
+	// The old parent loses the moved child
+	tree := load(t)
+	if err := tree.MoveAfter(6, 4); err != nil {
+		t.Fatalf("MoveAfter(6, 4) error = %v", err)
+	}
+	if children := tree.GetChildren(3); len(children) != 0 {
+		t.Errorf("GetChildren(3) = %v after moving its only child, want empty", children)
+	}
+	if got := tree.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, []int{2, 3, 4, 6, 5, 17, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}) {
+		t.Errorf("GetDescendantsIDs(1, 0) = %v after move", got)
+	}
+}
+
+func TestGetDescendantsGated(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	closed := func(ids ...int) func(TestCategory) bool {
+		return func(c TestCategory) bool { return !slices.Contains(ids, c.ID) }
+	}
+
+	tests := []struct {
+		name       string
+		id         int
+		canDescend func(TestCategory) bool
+		wantIDs    []int
+	}{
+		{"All open", 2, closed(), []int{4, 5, 17, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"Closed inner node", 2, closed(8), []int{4, 5, 17, 7, 8}},
+		{"Closed sibling subtrees", 1, closed(2, 3), []int{2, 3}},
+		{"Closed deep node", 8, closed(12), []int{9, 10, 11, 12}},
+		{"Closed start node", 1, closed(1), []int{}},
+		{"Missing node", 999, closed(), []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.GetDescendantsGated(tt.id, tt.canDescend)
+			ids := make([]int, len(nodes))
+			for i, node := range nodes {
+				ids[i] = node.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("GetDescendantsGated(%d) = %v, want %v", tt.id, ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestWithRepair(t *testing.T) {
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root"},
+		{ID: 2, ParentID: 1, Title: "Child"},
+		{ID: 3, ParentID: 99, Title: "Orphan"},
+		{ID: 4, ParentID: 3, Title: "Orphan's child"},
+		{ID: 2, ParentID: 0, Title: "Duplicate"},
+		{ID: 5, ParentID: 5, Title: "Self-parented"},
+		{ID: 2, ParentID: 0, Title: "Duplicate again"},
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithRepair[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Load() with repair error = %v", err)
+	}
+
+	report := tree.LastLoadReport()
+	if !reflect.DeepEqual(report.Rerooted, []int{3, 5}) {
+		t.Errorf("Rerooted = %v, want [3 5]", report.Rerooted)
+	}
+	if !reflect.DeepEqual(report.Duplicates, []int{2}) {
+		t.Errorf("Duplicates = %v, want [2]", report.Duplicates)
+	}
+
+	if got := tree.GetChildrenIDs(0); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("GetChildrenIDs(0) = %v, want [1 3 5]", got)
+	}
+	if got := tree.GetChildrenIDs(3); !reflect.DeepEqual(got, []int{4}) {
+		t.Errorf("GetChildrenIDs(3) = %v, want [4]", got)
+	}
+	if node, _ := tree.FindNode(2); node.Data.Title != "Child" || node.ParentID != 1 {
+		t.Errorf("FindNode(2) = %+v, want the first occurrence", node)
+	}
+
+	// Without repair the same data fails, and a clean load resets the report
+	err = tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err == nil {
+		t.Error("Load() without repair should fail")
+	}
+	if report := tree.LastLoadReport(); !reflect.DeepEqual(report.Rerooted, []int{3, 5}) {
+		t.Errorf("Rerooted = %v after a failed load, want the previous [3 5]", report.Rerooted)
+	}
+	err = tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithRepair[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	report = tree.LastLoadReport()
+	if len(report.Rerooted) != 0 || len(report.Duplicates) != 0 {
+		t.Errorf("LastLoadReport() = %+v after a clean load, want empty", report)
+	}
+
+	// Cycles spanning several nodes are not repaired, and the repairs of the
+	// failed load don't replace the report of the last successful one
+	err = tree.Load([]TestCategory{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 1}, {ID: 3, ParentID: 99}},
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithRepair[TestCategory](),
+	)
+	if err == nil {
+		t.Error("Load() with repair should still fail on a cycle")
+	}
+	report = tree.LastLoadReport()
+	if len(report.Rerooted) != 0 || len(report.Duplicates) != 0 {
+		t.Errorf("LastLoadReport() = %+v after a failed load, want the previous empty report", report)
+	}
+}
+
+func TestSortByField(t *testing.T) {
+	data := []TestCategory{
+		{ID: 1, ParentID: 0, Title: "Root"},
+		{ID: 2, ParentID: 1, Title: "b", Sort: 3},
+		{ID: 3, ParentID: 1, Title: "c", Sort: 1},
+		{ID: 4, ParentID: 1, Title: "a", Sort: 2},
+	}
+
+	tests := []struct {
+		name    string
+		option  LoadOption[TestCategory]
+		wantIDs []int
+		wantErr string
+	}{
+		{"Int field", SortByIntField[TestCategory]("Sort"), []int{3, 4, 2}, ""},
+		{"String field", SortByStringField[TestCategory]("Title"), []int{4, 2, 3}, ""},
+		{"Missing field", SortByIntField[TestCategory]("Missing"), nil, `sort field "Missing" is not an integer field of tree.TestCategory`},
+		{"Int on string field", SortByIntField[TestCategory]("Title"), nil, `sort field "Title" is not an integer field of tree.TestCategory`},
+		{"String on int field", SortByStringField[TestCategory]("Sort"), nil, `sort field "Sort" is not a string field of tree.TestCategory`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := New[TestCategory]()
+			err := tree.Load(data,
+				WithIDFunc(func(c TestCategory) int { return c.ID }),
+				WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+				tt.option,
+			)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load test data: %v", err)
+			}
+			if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("GetChildrenIDs(1) = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+
+	t.Run("Unsigned field", func(t *testing.T) {
+		type item struct {
+			ID, ParentID int
+			Weight       uint16
+		}
+		tree := New[item]()
+		err := tree.Load([]item{{1, 0, 0}, {2, 1, 9}, {3, 1, 4}},
+			WithIDFunc(func(i item) int { return i.ID }),
+			WithParentIDFunc(func(i item) int { return i.ParentID }),
+			SortByIntField[item]("Weight"),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, []int{3, 2}) {
+			t.Errorf("GetChildrenIDs(1) = %v, want [3 2]", got)
+		}
+	})
+
+	t.Run("Non-struct type", func(t *testing.T) {
+		err := New[int]().Load([]int{1},
+			WithIDFunc(func(v int) int { return v }),
+			WithParentIDFunc(func(v int) int { return 0 }),
+			SortByStringField[int]("Name"),
+		)
+		if err == nil {
+			t.Error("Load() error = nil, want an error for a non-struct type")
+		}
+	})
+}
+
+func TestWalkPostOrder(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	walk := func(rootID, limit int) [][2]int {
+		var visited [][2]int
+		tree.WalkPostOrder(rootID, func(node *Node[TestCategory], depth int) bool {
+			visited = append(visited, [2]int{node.ID, depth})
+			return len(visited) < limit
+		})
+		return visited
+	}
+
+	tests := []struct {
+		name   string
+		rootID int
+		limit  int
+		want   [][2]int // {ID, depth}
+	}{
+		{"Subtree", 5, 100, [][2]int{{7, 1}, {9, 2}, {11, 3}, {13, 4}, {15, 5}, {16, 5}, {14, 4}, {12, 3}, {10, 2}, {8, 1}, {5, 0}}},
+		{"Root with siblings", 3, 100, [][2]int{{6, 1}, {3, 0}}},
+		{"Leaf", 4, 100, [][2]int{{4, 0}}},
+		{"Early termination", 2, 3, [][2]int{{4, 1}, {7, 2}, {9, 3}}},
+		{"Missing root", 999, 100, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := walk(tt.rootID, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WalkPostOrder(%d) visited %v, want %v", tt.rootID, got, tt.want)
+			}
+		})
+	}
+
+	// Every node comes after all of its descendants
+	var order []int
+	tree.WalkPostOrder(1, func(node *Node[TestCategory], depth int) bool {
+		for _, id := range tree.GetDescendantsIDs(node.ID, 0) {
+			if !slices.Contains(order, id) {
+				t.Errorf("node %d visited before its descendant %d", node.ID, id)
+			}
+		}
+		order = append(order, node.ID)
+		return true
+	})
+	if len(order) != 17 {
+		t.Errorf("WalkPostOrder(1) visited %d nodes, want 17", len(order))
+	}
+}
+
+func TestToJSONIndent(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	got, err := tree.ToJSONIndent(3, "", "  ")
+	if err != nil {
+		t.Fatalf("ToJSONIndent(3) error = %v", err)
+	}
+	want := `{
+  "id": 3,
+  "parent_id": 1,
+  "data": {
+    "id": 3,
+    "parent_id": 1,
+    "title": "Child 2",
+    "sort": 0
+  },
+  "children": [
+    {
+      "id": 6,
+      "parent_id": 3,
+      "data": {
+        "id": 6,
+        "parent_id": 3,
+        "title": "Child 2.1",
+        "sort": 0
+      }
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("ToJSONIndent(3) =\n%s\nwant\n%s", got, want)
+	}
+
+	// Repeated calls produce identical output
+	first, _ := tree.ToJSONIndent(1, "", "\t")
+	second, _ := tree.ToJSONIndent(1, "", "\t")
+	if string(first) != string(second) {
+		t.Error("ToJSONIndent(1) is not deterministic")
+	}
+
+	if _, err := tree.ToJSONIndent(999, "", "  "); err == nil || err.Error() != "root node 999 not found" {
+		t.Errorf("ToJSONIndent(999) error = %v, want %q", err, "root node 999 not found")
+	}
+}
+
+func TestSubtreeWidthByDepth(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rootID int
+		want   []int
+	}{
+		{"Whole tree", 1, []int{1, 2, 4, 2, 2, 2, 2, 2}},
+		{"Inner subtree", 5, []int{1, 2, 2, 2, 2, 2}},
+		{"Leaf", 4, []int{1}},
+		{"Missing root", 999, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.SubtreeWidthByDepth(tt.rootID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubtreeWidthByDepth(%d) = %v, want %v", tt.rootID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFirstInOrder(t *testing.T) {
+	data := append(getTestData(), TestCategory{ID: 20, ParentID: 0, Title: "Child 9"})
+	tree := New[TestCategory]()
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		match  func(TestCategory) bool
+		wantID int // 0 for no match
+	}{
+		{"Topmost match", func(c TestCategory) bool { return strings.HasPrefix(c.Title, "Child") }, 2},
+		{"Leftmost deep match", func(c TestCategory) bool { return strings.Count(c.Title, ".") == 2 }, 7},
+		{"Depth-first before later sibling", func(c TestCategory) bool { return c.ID == 9 || c.ID == 17 }, 9},
+		{"Second root", func(c TestCategory) bool { return c.Title == "Child 9" }, 20},
+		{"No match", func(c TestCategory) bool { return false }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tree.FindFirstInOrder(tt.match)
+			if tt.wantID == 0 {
+				if node != nil {
+					t.Errorf("FindFirstInOrder() = %v, want nil", node)
+				}
+				return
+			}
+			if node == nil || node.ID != tt.wantID {
+				t.Errorf("FindFirstInOrder() = %v, want node %d", node, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestLastLoadStats(t *testing.T) {
+	tree := New[TestCategory]()
+	if stats := tree.LastLoadStats(); stats != (LoadStats{}) {
+		t.Errorf("LastLoadStats() before Load = %+v, want zero", stats)
+	}
+
+	opts := []LoadOption[TestCategory]{
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	}
+	if err := tree.Load(getTestData(), opts...); err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	stats := tree.LastLoadStats()
+	if stats.Nodes != 17 {
+		t.Errorf("Nodes = %d, want 17", stats.Nodes)
+	}
+	if stats.Validate < 0 || stats.Build < 0 || stats.Sort < 0 {
+		t.Errorf("LastLoadStats() has negative durations: %+v", stats)
+	}
+
+	items := map[int]TestCategory{1: {ID: 1, Title: "Root"}, 2: {ID: 2, ParentID: 1, Title: "Child"}}
+	if err := tree.LoadMap(items, opts...); err != nil {
+		t.Fatalf("LoadMap() error = %v", err)
+	}
+	if got := tree.LastLoadStats().Nodes; got != 2 {
+		t.Errorf("Nodes after LoadMap = %d, want 2", got)
+	}
+
+	// Loads rejected during ID validation leave the stats untouched
+	if err := tree.Load([]TestCategory{{ID: 0}}, opts...); err == nil {
+		t.Fatal("Load() with invalid ID should fail")
+	}
+	if got := tree.LastLoadStats().Nodes; got != 2 {
+		t.Errorf("Nodes after failed Load = %d, want 2", got)
+	}
+}
+
+func TestGetDescendantsCapped(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		maxNodes int
+		want     []int
+	}{
+		{"Cap within first level", 1, 1, []int{2}},
+		{"Cap across levels", 1, 5, []int{2, 3, 4, 5, 17}},
+		{"Cap larger than subtree", 5, 100, []int{7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"Whole tree in level order", 1, 16, []int{2, 3, 4, 5, 17, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"Zero cap", 1, 0, []int{}},
+		{"Negative cap", 1, -1, []int{}},
+		{"Leaf node", 7, 10, []int{}},
+		{"Non-existent node", 999, 10, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.GetDescendantsCapped(tt.id, tt.maxNodes)
+			got := make([]int, 0, len(nodes))
+			for _, node := range nodes {
+				got = append(got, node.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetDescendantsCapped(%d, %d) = %v, want %v", tt.id, tt.maxNodes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOneWithDepth(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		title     string
+		wantID    int
+		wantDepth int
+		wantOK    bool
+	}{
+		{"Root", "Root", 1, 0, true},
+		{"Direct child", "Child 2", 3, 1, true},
+		{"Deep node", "Child 1.2.2.2.2.2.1", 15, 7, true},
+		{"No match", "Missing", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, depth, ok := tree.GetOneWithDepth(func(c TestCategory) bool { return c.Title == tt.title })
+			if ok != tt.wantOK || depth != tt.wantDepth {
+				t.Fatalf("GetOneWithDepth() depth, ok = %d, %v, want %d, %v", depth, ok, tt.wantDepth, tt.wantOK)
+			}
+			if !ok {
+				if node != nil {
+					t.Errorf("GetOneWithDepth() node = %v, want nil", node)
+				}
+				return
+			}
+			if node.ID != tt.wantID {
+				t.Errorf("GetOneWithDepth() node ID = %d, want %d", node.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestReorderValues(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if err := tree.MoveBefore(17, 4); err != nil {
+		t.Fatalf("MoveBefore() error = %v", err)
+	}
+
+	values := tree.ReorderValues(func(c TestCategory, index int) TestCategory {
+		c.Sort = index
+		return c
+	})
+	if len(values) != 17 {
+		t.Errorf("ReorderValues() returned %d values, want 17", len(values))
+	}
+
+	want := map[int]int{1: 0, 2: 0, 3: 1, 17: 0, 4: 1, 5: 2, 9: 0, 10: 1}
+	for id, sort := range want {
+		if got := values[id].Sort; got != sort {
+			t.Errorf("values[%d].Sort = %d, want %d", id, got, sort)
+		}
+	}
+	if values[17].Title != "Child 1.3" {
+		t.Errorf("values[17].Title = %q, want other fields kept", values[17].Title)
+	}
+
+	// The tree keeps its data
+	for _, child := range tree.GetChildren(2) {
+		if child.Data.Sort != 0 {
+			t.Errorf("node %d Data.Sort = %d, want the tree unchanged", child.ID, child.Data.Sort)
+		}
+	}
+}
+
+func TestGetChildrenWithHasChildren(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		id              int
+		wantIDs         []int
+		wantHasChildren []bool
+	}{
+		{"Mixed children", 2, []int{4, 5, 17}, []bool{false, true, false}},
+		{"Root level", 0, []int{1}, []bool{true}},
+		{"Leaf node", 7, []int{}, []bool{}},
+		{"Non-existent node", 999, []int{}, []bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children := tree.GetChildrenWithHasChildren(tt.id)
+			gotIDs := make([]int, 0, len(children))
+			gotHasChildren := make([]bool, 0, len(children))
+			for _, child := range children {
+				gotIDs = append(gotIDs, child.Node.ID)
+				gotHasChildren = append(gotHasChildren, child.HasChildren)
+			}
+			if !reflect.DeepEqual(gotIDs, tt.wantIDs) || !reflect.DeepEqual(gotHasChildren, tt.wantHasChildren) {
+				t.Errorf("GetChildrenWithHasChildren(%d) = %v %v, want %v %v",
+					tt.id, gotIDs, gotHasChildren, tt.wantIDs, tt.wantHasChildren)
+			}
+		})
+	}
+}
+
+func BenchmarkFormatTreeDisplay(b *testing.B) {
+	tree := New[TestCategory]()
+	err := tree.Load(buildWideTree(80000, 4),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		b.Fatalf("Failed to load test data: %v", err)
+	}
+
+	b.Run("DisplayField", func(b *testing.B) {
+		opt := DefaultFormatOption()
+		opt.DisplayField = "Title"
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tree.FormatTreeDisplayNoCache(1, opt)
+		}
+	})
+
+	b.Run("Cached", func(b *testing.B) {
+		opt := DefaultFormatOption()
+		opt.DisplayField = "Title"
+		tree.FormatTreeDisplay(1, opt)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.FormatTreeDisplay(1, opt)
+		}
+	})
+
+	b.Run("DisplayFunc", func(b *testing.B) {
+		opt := DefaultFormatOption()
+		label := func(c TestCategory) string { return c.Title }
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tree.FormatTreeDisplayFunc(1, label, opt)
+		}
+	})
+}
+
+func TestAddNode(t *testing.T) {
+	if err := New[TestCategory]().AddNode(TestCategory{ID: 1}); err == nil {
+		t.Error("AddNode() before Load should fail")
+	}
+
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Title < b.Title }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	before := tree.GetChildren(2)
+
+	tests := []struct {
+		name    string
+		item    TestCategory
+		wantErr string
+	}{
+		{"Sorted among siblings", TestCategory{ID: 20, ParentID: 2, Title: "Child 1.15"}, ""},
+		{"New root", TestCategory{ID: 21, ParentID: 0, Title: "Root 2"}, ""},
+		{"Under a leaf", TestCategory{ID: 22, ParentID: 7, Title: "Child 1.2.1.1"}, ""},
+		{"Duplicate ID", TestCategory{ID: 4, ParentID: 2}, "duplicate node ID: 4"},
+		{"Non-positive ID", TestCategory{ID: 0, ParentID: 1}, "node 0: ID must be positive"},
+		{"Missing parent", TestCategory{ID: 23, ParentID: 999}, "parent node 999 not found"},
+		{"Self parent", TestCategory{ID: 24, ParentID: 24}, "node 24: node is its own parent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tree.AddNode(tt.item)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("AddNode() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddNode() error = %v", err)
+			}
+			if node, ok := tree.FindNode(tt.item.ID); !ok || node.ParentID != tt.item.ParentID {
+				t.Errorf("FindNode(%d) = %v, %v after AddNode", tt.item.ID, node, ok)
+			}
+		})
+	}
+
+	if got, want := tree.GetChildrenIDs(2), []int{4, 20, 5, 17}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) = %v, want %v", got, want)
+	}
+	if got, want := tree.GetChildrenIDs(0), []int{1, 21}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(0) = %v, want %v", got, want)
+	}
+	if len(before) != 3 {
+		t.Errorf("children slice returned before AddNode changed to %d nodes", len(before))
+	}
+
+	// A manual order from MoveBefore is kept, the new node goes last
+	if err := tree.MoveBefore(17, 4); err != nil {
+		t.Fatalf("MoveBefore() error = %v", err)
+	}
+	if err := tree.AddNode(TestCategory{ID: 25, ParentID: 2, Title: "Child 1.0"}); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if got, want := tree.GetChildrenIDs(2), []int{17, 4, 20, 5, 25}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) after MoveBefore = %v, want %v", got, want)
+	}
+
+	// Other lists are still sorted, and the next Load drops the manual order
+	if err := tree.AddNode(TestCategory{ID: 26, ParentID: 5, Title: "Child 1.2.0"}); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if got, want := tree.GetChildrenIDs(5), []int{26, 7, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(5) = %v, want %v", got, want)
+	}
+	err = tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Title < b.Title }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if err := tree.AddNode(TestCategory{ID: 25, ParentID: 2, Title: "Child 1.0"}); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if got, want := tree.GetChildrenIDs(2), []int{25, 4, 5, 17}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) after Load = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	load := func(t *testing.T) *Tree[TestCategory] {
+		tree := New[TestCategory]()
+		err := tree.Load(getTestData(),
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		return tree
+	}
+
+	t.Run("Cascade", func(t *testing.T) {
+		tree := load(t)
+		tree.SetMeta(8, "expanded", true)
+		if err := tree.RemoveNode(8, RemoveCascade); err != nil {
+			t.Fatalf("RemoveNode() error = %v", err)
+		}
+		for id := 8; id <= 16; id++ {
+			if _, exists := tree.FindNode(id); exists {
+				t.Errorf("Node %d should have been removed", id)
+			}
+		}
+		if _, exists := tree.GetMeta(8, "expanded"); exists {
+			t.Error("Metadata of removed node 8 should be dropped")
+		}
+		if got := tree.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, []int{2, 3, 4, 5, 17, 7, 6}) {
+			t.Errorf("GetDescendantsIDs(1, 0) = %v after removal", got)
+		}
+	})
+
+	t.Run("Reparent", func(t *testing.T) {
+		tree := load(t)
+		before := tree.GetChildren(2)
+		if err := tree.RemoveNode(5, RemoveReparent); err != nil {
+			t.Fatalf("RemoveNode() error = %v", err)
+		}
+		if _, exists := tree.FindNode(5); exists {
+			t.Error("Node 5 should have been removed")
+		}
+		if got := tree.GetChildrenIDs(2); !reflect.DeepEqual(got, []int{4, 7, 8, 17}) {
+			t.Errorf("GetChildrenIDs(2) = %v, want [4 7 8 17]", got)
+		}
+		for _, id := range []int{7, 8} {
+			if node, _ := tree.FindNode(id); node.ParentID != 2 {
+				t.Errorf("node %d ParentID = %d, want 2", id, node.ParentID)
+			}
+		}
+		// The grandchildren stay below the moved nodes
+		if got := tree.GetChildrenIDs(8); !reflect.DeepEqual(got, []int{9, 10}) {
+			t.Errorf("GetChildrenIDs(8) = %v, want [9 10]", got)
+		}
+		if got := tree.GetChildrenIDs(5); len(got) != 0 {
+			t.Errorf("GetChildrenIDs(5) = %v, want empty", got)
+		}
+		if len(before) != 3 || before[1].ID != 5 {
+			t.Error("children slice returned before RemoveNode was modified")
+		}
+	})
+
+	t.Run("Reparent leaf", func(t *testing.T) {
+		tree := load(t)
+		if err := tree.RemoveNode(17, RemoveReparent); err != nil {
+			t.Fatalf("RemoveNode() error = %v", err)
+		}
+		if got := tree.GetChildrenIDs(2); !reflect.DeepEqual(got, []int{4, 5}) {
+			t.Errorf("GetChildrenIDs(2) = %v, want [4 5]", got)
+		}
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		tree := load(t)
+		err := tree.RemoveNode(1, RemoveReparent)
+		if err == nil || err.Error() != "cannot reparent the children of root node 1" {
+			t.Errorf("RemoveNode(1, RemoveReparent) error = %v", err)
+		}
+		if _, exists := tree.FindNode(1); !exists {
+			t.Error("A failed RemoveNode should keep the root")
+		}
+
+		if err := tree.RemoveNode(1, RemoveCascade); err != nil {
+			t.Fatalf("RemoveNode(1, RemoveCascade) error = %v", err)
+		}
+		if got := tree.GetChildren(0); len(got) != 0 {
+			t.Errorf("GetChildren(0) = %v after removing the only root, want empty", got)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tree := load(t)
+		if err := tree.RemoveNode(999, RemoveCascade); err == nil || err.Error() != "node 999 not found" {
+			t.Errorf("RemoveNode(999) error = %v", err)
+		}
+		if err := tree.RemoveNode(5, RemoveStrategy(99)); err == nil || err.Error() != "unknown remove strategy 99" {
+			t.Errorf("RemoveNode() with unknown strategy error = %v", err)
+		}
+		if _, exists := tree.FindNode(5); !exists {
+			t.Error("A failed RemoveNode should keep the node")
+		}
+	})
+}
+
+func TestGetDescendantsBFS(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       int
+		maxDepth int
+		want     []int
+	}{
+		{"Unlimited", 1, DepthUnlimited, []int{2, 3, 4, 5, 17, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{"Two levels", 1, 2, []int{2, 3, 4, 5, 17, 6}},
+		{"One level", 2, 1, []int{4, 5, 17}},
+		{"Subtree", 5, 3, []int{7, 8, 9, 10, 11, 12}},
+		{"DepthNone", 1, DepthNone, []int{}},
+		{"Leaf node", 7, 0, []int{}},
+		{"Non-existent node", 999, 0, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tree.GetDescendantsBFS(tt.id, tt.maxDepth)
+			got := make([]int, 0, len(nodes))
+			for _, node := range nodes {
+				got = append(got, node.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetDescendantsBFS(%d, %d) = %v, want %v", tt.id, tt.maxDepth, got, tt.want)
+			}
+
+			// Same nodes as GetDescendants, only the order differs
+			dfs := tree.GetDescendantsIDs(tt.id, tt.maxDepth)
+			slices.Sort(got)
+			slices.Sort(dfs)
+			if !reflect.DeepEqual(got, dfs) {
+				t.Errorf("GetDescendantsBFS(%d, %d) IDs = %v, GetDescendants has %v", tt.id, tt.maxDepth, got, dfs)
+			}
+		})
+	}
+
+	// The orders differ once the subtree is deeper than one level
+	bfs := tree.GetDescendantsBFS(1, 0)
+	dfs := tree.GetDescendants(1, 0)
+	if reflect.DeepEqual(bfs, dfs) {
+		t.Error("GetDescendantsBFS() should return a different order than GetDescendants()")
+	}
+}
+
+func TestDescendantsIterator(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	for _, tt := range []struct {
+		id       int
+		maxDepth int
+	}{{1, 0}, {1, 2}, {2, 1}, {5, 3}, {1, DepthNone}, {7, 0}, {999, 0}} {
+		want := tree.GetDescendants(tt.id, tt.maxDepth)
+		got := slices.Collect(tree.Descendants(tt.id, tt.maxDepth))
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Descendants(%d, %d) = %v, want %v", tt.id, tt.maxDepth, got, want)
+		}
+	}
+
+	// Breaking early stops the traversal and releases the lock
+	var visited []int
+	for node := range tree.Descendants(1, 0) {
+		visited = append(visited, node.ID)
+		if node.ID == 4 {
+			break
+		}
+	}
+	if want := []int{2, 3, 4}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Descendants(1, 0) with break visited %v, want %v", visited, want)
+	}
+	tree.SetMeta(1, "key", "value") // Would deadlock if the read lock were still held
+}
+
+func TestAncestorsIterator(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	for _, id := range []int{1, 4, 15, 999} {
+		for _, includeSelf := range []bool{false, true} {
+			want := tree.GetAncestors(id, includeSelf)
+			got := slices.Collect(tree.Ancestors(id, includeSelf))
+			if len(got) == 0 && len(want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Ancestors(%d, %v) = %v, want %v", id, includeSelf, got, want)
+			}
+		}
+	}
+
+	var visited []int
+	for node := range tree.Ancestors(15, true) {
+		visited = append(visited, node.ID)
+		if node.ID == 12 {
+			break
+		}
+	}
+	if want := []int{15, 14, 12}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Ancestors(15, true) with break visited %v, want %v", visited, want)
+	}
+	tree.SetMeta(1, "key", "value") // Would deadlock if the read lock were still held
+}
+
+func TestGetDepthAndHeight(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		id         int
+		wantDepth  int
+		wantHeight int
+	}{
+		{"Root", 1, 0, 7},
+		{"Direct child", 2, 1, 6},
+		{"Short branch", 3, 1, 1},
+		{"Middle node", 8, 3, 4},
+		{"Deepest leaf", 15, 7, 0},
+		{"Shallow leaf", 17, 2, 0},
+		{"Non-existent node", 999, -1, -1},
+		{"Root level ID", 0, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.GetDepth(tt.id); got != tt.wantDepth {
+				t.Errorf("GetDepth(%d) = %d, want %d", tt.id, got, tt.wantDepth)
+			}
+			if got := tree.GetHeight(tt.id); got != tt.wantHeight {
+				t.Errorf("GetHeight(%d) = %d, want %d", tt.id, got, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCountNodesAndDescendants(t *testing.T) {
+	tree := New[TestCategory]()
+	if got := tree.CountNodes(); got != 0 {
+		t.Errorf("CountNodes() on empty tree = %d, want 0", got)
+	}
+
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	if got := tree.CountNodes(); got != 17 {
+		t.Errorf("CountNodes() = %d, want 17", got)
+	}
+
+	tests := []struct {
+		id   int
+		want int
+	}{
+		{1, 16},
+		{2, 13},
+		{8, 8},
+		{3, 1},
+		{7, 0},
+		{999, -1},
+	}
+	for _, tt := range tests {
+		if got := tree.CountDescendants(tt.id); got != tt.want {
+			t.Errorf("CountDescendants(%d) = %d, want %d", tt.id, got, tt.want)
+		}
+		if tt.want >= 0 {
+			if n := len(tree.GetDescendants(tt.id, 0)); n != tt.want {
+				t.Errorf("CountDescendants(%d) = %d, but GetDescendants has %d nodes", tt.id, tt.want, n)
+			}
+		}
+	}
+}
+
+func TestGetRoots(t *testing.T) {
+	tree := New[TestCategory]()
+	if roots := tree.GetRoots(); roots == nil || len(roots) != 0 {
+		t.Errorf("GetRoots() on empty tree = %v, want empty slice", roots)
+	}
+
+	data := append(getTestData(),
+		TestCategory{ID: 30, ParentID: 0, Title: "Root 3"},
+		TestCategory{ID: 20, ParentID: 0, Title: "Root 2"},
+		TestCategory{ID: 21, ParentID: 20, Title: "Child 2.1"},
+	)
+	err := tree.Load(data,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	want := []int{1, 20, 30}
+	if got := tree.GetRootIDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRootIDs() = %v, want %v", got, want)
+	}
+	roots := tree.GetRoots()
+	if len(roots) != len(want) {
+		t.Fatalf("GetRoots() got %d nodes, want %d", len(roots), len(want))
+	}
+	for i, root := range roots {
+		if root.ID != want[i] || root.ParentID != 0 {
+			t.Errorf("GetRoots()[%d] = %v, want root %d", i, root, want[i])
+		}
+	}
+}
+
+func TestIsAncestorAndIsDescendant(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ancestor int
+		node     int
+		want     bool
+	}{
+		{"Parent", 2, 4, true},
+		{"Root of deep node", 1, 15, true},
+		{"Intermediate", 8, 13, true},
+		{"Reversed", 4, 2, false},
+		{"Self", 5, 5, false},
+		{"Sibling", 4, 5, false},
+		{"Other branch", 3, 7, false},
+		{"Missing ancestor", 999, 4, false},
+		{"Missing node", 1, 999, false},
+		{"Root level ID", 0, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tree.IsAncestor(tt.ancestor, tt.node); got != tt.want {
+				t.Errorf("IsAncestor(%d, %d) = %v, want %v", tt.ancestor, tt.node, got, tt.want)
+			}
+			if got := tree.IsDescendant(tt.node, tt.ancestor); got != tt.want {
+				t.Errorf("IsDescendant(%d, %d) = %v, want %v", tt.node, tt.ancestor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFromNested(t *testing.T) {
+	src := New[TestCategory]()
+	err := src.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		dst := New[TestCategory]()
+		if err := dst.LoadFromNested(src.ToTree(1)); err != nil {
+			t.Fatalf("LoadFromNested() error = %v", err)
+		}
+		if !reflect.DeepEqual(dst.ToTree(1), src.ToTree(1)) {
+			t.Error("LoadFromNested(ToTree(1)) doesn't reproduce the tree")
+		}
+		if got := dst.CountNodes(); got != 17 {
+			t.Errorf("CountNodes() = %d, want 17", got)
+		}
+	})
+
+	t.Run("JSON round trip", func(t *testing.T) {
+		data, err := src.ToJSONIndent(1, "", "  ")
+		if err != nil {
+			t.Fatalf("ToJSONIndent() error = %v", err)
+		}
+		dst := New[TestCategory]()
+		if err := dst.LoadFromJSON(data); err != nil {
+			t.Fatalf("LoadFromJSON() error = %v", err)
+		}
+		if !reflect.DeepEqual(dst.ToTree(1), src.ToTree(1)) {
+			t.Error("LoadFromJSON(ToJSONIndent(1)) doesn't reproduce the tree")
+		}
+	})
+
+	t.Run("Sort option", func(t *testing.T) {
+		dst := New[TestCategory]()
+		err := dst.LoadFromNested(src.ToTree(1),
+			WithSort(func(a, b TestCategory) bool { return a.Title > b.Title }),
+		)
+		if err != nil {
+			t.Fatalf("LoadFromNested() error = %v", err)
+		}
+		if got, want := dst.GetChildrenIDs(2), []int{17, 5, 4}; !reflect.DeepEqual(got, want) {
+			t.Errorf("GetChildrenIDs(2) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Input is not modified", func(t *testing.T) {
+		root := src.ToTree(1)
+		dst := New[TestCategory]()
+		if err := dst.LoadFromNested(root); err != nil {
+			t.Fatalf("LoadFromNested() error = %v", err)
+		}
+		if node, _ := dst.FindNode(1); node == root || len(node.Children) != 0 {
+			t.Error("LoadFromNested() should store copies without children")
+		}
+		if len(root.Children) != 2 {
+			t.Errorf("input root has %d children after load, want 2", len(root.Children))
+		}
+	})
+
+	t.Run("Subtree root", func(t *testing.T) {
+		dst := New[TestCategory]()
+		if err := dst.LoadFromNested(src.ToTree(5)); err != nil {
+			t.Fatalf("LoadFromNested(ToTree(5)) error = %v", err)
+		}
+		if got := dst.GetRootIDs(); !reflect.DeepEqual(got, []int{5}) {
+			t.Errorf("GetRootIDs() = %v, want [5]", got)
+		}
+		if got := dst.LastLoadReport().Rerooted; len(got) != 0 {
+			t.Errorf("LastLoadReport().Rerooted = %v, want none", got)
+		}
+		if got, want := dst.GetDescendantsIDs(5, 0), src.GetDescendantsIDs(5, 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetDescendantsIDs(5, 0) = %v, want %v", got, want)
+		}
+
+		// The subtree round-trips through ToTree again, now as a root
+		want := src.ToTree(5)
+		want.ParentID = 0
+		if got := dst.ToTree(5); !reflect.DeepEqual(got, want) {
+			t.Error("ToTree(5) after LoadFromNested(ToTree(5)) doesn't reproduce the subtree")
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		root    *Node[TestCategory]
+		wantErr string
+	}{
+		{"Nil root", nil, "invalid data: empty data"},
+		{"Non-positive ID", &Node[TestCategory]{ID: 0}, "invalid data: node 0: ID must be positive"},
+		{"Negative parent ID", &Node[TestCategory]{ID: 1, ParentID: -1}, "invalid data: node 1: parent ID cannot be negative"},
+		{"Mismatched parent", &Node[TestCategory]{ID: 1, Children: []*Node[TestCategory]{{ID: 2, ParentID: 3}}},
+			"invalid data: node 2: parent ID 3 doesn't match its parent node 1"},
+		{"Duplicate ID", &Node[TestCategory]{ID: 1, Children: []*Node[TestCategory]{{ID: 2, ParentID: 1}, {ID: 2, ParentID: 1}}},
+			"invalid data: duplicate node ID: 2"},
+		{"Nil child", &Node[TestCategory]{ID: 1, Children: []*Node[TestCategory]{nil}}, "invalid data: node 1 has a nil child"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New[TestCategory]().LoadFromNested(tt.root)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("LoadFromNested() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Repair mode lets duplicate IDs through, a pointer cycle must still end
+	cyclic := &Node[TestCategory]{ID: 1, ParentID: 2}
+	cyclic.Children = []*Node[TestCategory]{{ID: 2, ParentID: 1, Children: []*Node[TestCategory]{cyclic}}}
+	err = New[TestCategory]().LoadFromNested(cyclic, WithRepair[TestCategory]())
+	if err == nil || err.Error() != "invalid data: node 1 is nested inside itself" {
+		t.Errorf("LoadFromNested() with pointer cycle error = %v", err)
+	}
+
+	if err := New[TestCategory]().LoadFromJSON([]byte("{")); err == nil || !strings.HasPrefix(err.Error(), "invalid JSON: ") {
+		t.Errorf("LoadFromJSON() with malformed input error = %v", err)
+	}
+}
+
+func TestTreeMarshalJSON(t *testing.T) {
+	tree := New[TestCategory]()
+	data, err := json.Marshal(tree)
+	if err != nil || string(data) != "[]" {
+		t.Errorf("json.Marshal(empty tree) = %s, %v, want []", data, err)
+	}
+
+	items := append(getTestData(),
+		TestCategory{ID: 20, ParentID: 0, Title: "Root 2"},
+		TestCategory{ID: 21, ParentID: 20, Title: "Child 2.1"},
+	)
+	err = tree.Load(items,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("json.Marshal(tree) error = %v", err)
+	}
+	var got []*Node[TestCategory]
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := []*Node[TestCategory]{tree.ToTree(1), tree.ToTree(20)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Marshal(tree) = %s, want the ToTree output of roots 1 and 20", data)
+	}
+
+	// Each element can be reloaded on its own
+	reloaded := New[TestCategory]()
+	if err := reloaded.LoadFromNested(got[1]); err != nil {
+		t.Fatalf("LoadFromNested() error = %v", err)
+	}
+	if ids := reloaded.GetDescendantsIDs(20, 0); !reflect.DeepEqual(ids, []int{21}) {
+		t.Errorf("GetDescendantsIDs(20, 0) = %v, want [21]", ids)
+	}
+}
+
+func TestGetForest(t *testing.T) {
+	tree := New[TestCategory]()
+	if forest := tree.GetForest(); forest == nil || len(forest) != 0 {
+		t.Errorf("GetForest() on empty tree = %v, want empty slice", forest)
+	}
+
+	items := append(getTestData(),
+		TestCategory{ID: 30, ParentID: 0, Title: "Root 3"},
+		TestCategory{ID: 20, ParentID: 0, Title: "Root 2"},
+		TestCategory{ID: 21, ParentID: 20, Title: "Child 2.1"},
+	)
+	err := tree.Load(items,
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	forest := tree.GetForest()
+	want := []*Node[TestCategory]{tree.ToTree(1), tree.ToTree(20), tree.ToTree(30)}
+	if !reflect.DeepEqual(forest, want) {
+		t.Errorf("GetForest() = %v, want the ToTree output of roots 1, 20 and 30", forest)
+	}
+
+	// The nested nodes are copies, changing them leaves the tree intact
+	forest[0].Children = nil
+	if got := tree.GetChildrenIDs(1); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("GetChildrenIDs(1) = %v after modifying the forest, want [2 3]", got)
+	}
+}
+
+func TestFilterTree(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	// ids flattens a nested result into "id(children...)" for easy comparison
+	var ids func(node *Node[TestCategory]) string
+	ids = func(node *Node[TestCategory]) string {
+		if node == nil {
+			return "<nil>"
+		}
+		var sb strings.Builder
+		fmt.Fprint(&sb, node.ID)
+		if len(node.Children) > 0 {
+			parts := make([]string, len(node.Children))
+			for i, child := range node.Children {
+				parts[i] = ids(child)
+			}
+			sb.WriteString("(" + strings.Join(parts, " ") + ")")
+		}
+		return sb.String()
+	}
+	titleIs := func(titles ...string) func(TestCategory) bool {
+		return func(c TestCategory) bool { return slices.Contains(titles, c.Title) }
+	}
+
+	tests := []struct {
+		name   string
+		rootID int
+		keep   func(TestCategory) bool
+		want   string
+	}{
+		{"Single deep match", 1, titleIs("Child 1.2.1"), "1(2(5(7)))"},
+		{"Matches in two branches", 1, titleIs("Child 1.1", "Child 2.1"), "1(2(4) 3(6))"},
+		{"Match with matching descendant", 1, titleIs("Child 1.2", "Child 1.2.2.1"), "1(2(5(8(9))))"},
+		{"Only the root matches", 1, titleIs("Root"), "1"},
+		{"Subtree root", 8, titleIs("Child 1.2.2.2.1", "Child 1.2.2.2.2.2.2"), "8(10(11 12(14(16))))"},
+		{"Match outside the subtree", 3, titleIs("Child 1.1"), "<nil>"},
+		{"No match", 1, titleIs("Missing"), "<nil>"},
+		{"Non-existent root", 999, titleIs("Root"), "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tree.FilterTree(tt.rootID, tt.keep)); got != tt.want {
+				t.Errorf("FilterTree(%d) = %s, want %s", tt.rootID, got, tt.want)
+			}
+		})
+	}
+
+	// The result is a copy
+	result := tree.FilterTree(1, titleIs("Child 1.1"))
+	result.Children[0].Children = nil
+	if got := tree.GetChildrenIDs(2); !reflect.DeepEqual(got, []int{4, 5, 17}) {
+		t.Errorf("GetChildrenIDs(2) = %v after modifying the result, want [4 5 17]", got)
+	}
+}
+
+func TestUpdateNodeData(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Title < b.Title }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	before := tree.GetChildren(2)
+	old, _ := tree.FindNode(4)
+
+	// Renaming "Child 1.1" moves it after "Child 1.3"
+	if err := tree.UpdateNodeData(4, TestCategory{ID: 4, ParentID: 2, Title: "Child 1.4"}); err != nil {
+		t.Fatalf("UpdateNodeData() error = %v", err)
+	}
+	if node, _ := tree.FindNode(4); node.Data.Title != "Child 1.4" {
+		t.Errorf("FindNode(4).Data.Title = %q, want %q", node.Data.Title, "Child 1.4")
+	}
+	if got, want := tree.GetChildrenIDs(2), []int{5, 17, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) = %v, want %v", got, want)
+	}
+	if old.Data.Title != "Child 1.1" || before[0].ID != 4 {
+		t.Error("nodes and slices obtained before UpdateNodeData should not change")
+	}
+
+	// The children of the updated node are kept
+	if err := tree.UpdateNodeData(5, TestCategory{ID: 5, ParentID: 2, Title: "Renamed"}); err != nil {
+		t.Fatalf("UpdateNodeData() error = %v", err)
+	}
+	if got := tree.GetChildrenIDs(5); !reflect.DeepEqual(got, []int{7, 8}) {
+		t.Errorf("GetChildrenIDs(5) = %v, want [7 8]", got)
+	}
+
+	// Siblings ordered by MoveBefore keep their manual order
+	if err := tree.MoveBefore(5, 17); err != nil {
+		t.Fatalf("MoveBefore() error = %v", err)
+	}
+	if err := tree.UpdateNodeData(17, TestCategory{ID: 17, ParentID: 2, Title: "A first"}); err != nil {
+		t.Fatalf("UpdateNodeData() error = %v", err)
+	}
+	if got, want := tree.GetChildrenIDs(2), []int{5, 17, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) after MoveBefore = %v, want %v", got, want)
+	}
+	if err := tree.UpdateNodeData(17, TestCategory{ID: 17, ParentID: 2, Title: "Z last"}); err != nil {
+		t.Fatalf("UpdateNodeData() error = %v", err)
+	}
+	if got, want := tree.GetChildrenIDs(2), []int{5, 17, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(2) after renaming = %v, want %v", got, want)
+	}
+
+	errorTests := []struct {
+		name    string
+		id      int
+		data    TestCategory
+		wantErr string
+	}{
+		{"Missing node", 999, TestCategory{ID: 999}, "node 999 not found"},
+		{"Different ID", 4, TestCategory{ID: 6, ParentID: 2}, "node 4: data has ID 6"},
+		{"Different parent", 4, TestCategory{ID: 4, ParentID: 3}, "node 4: data has parent ID 3, want 2"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tree.UpdateNodeData(tt.id, tt.data)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("UpdateNodeData() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if node, _ := tree.FindNode(4); node.Data.Title != "Child 1.4" {
+		t.Errorf("failed updates changed the data to %v", node.Data)
+	}
+
+	nested := New[TestCategory]()
+	if err := nested.LoadFromNested(tree.ToTree(1)); err != nil {
+		t.Fatalf("LoadFromNested() error = %v", err)
+	}
+	if err := nested.UpdateNodeData(4, TestCategory{ID: 4, ParentID: 2}); err == nil {
+		t.Error("UpdateNodeData() without ID functions should fail")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	opts := []LoadOption[TestCategory]{
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	}
+	load := func(data []TestCategory) error {
+		return New[TestCategory]().Load(data, opts...)
+	}
+
+	tree := New[TestCategory]()
+	if err := tree.Load(getTestData(), opts...); err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		want   error
+		wantID int // 0 if the error is not about a single node
+	}{
+		{"Empty data", load(nil), ErrEmptyData, 0},
+		{"Non-positive ID", load([]TestCategory{{ID: -3}}), ErrInvalidID, -3},
+		{"Duplicate ID", load([]TestCategory{{ID: 1}, {ID: 1}}), ErrDuplicateID, 1},
+		{"Negative parent", load([]TestCategory{{ID: 1, ParentID: -1}}), ErrInvalidParent, 1},
+		{"Missing parent", load([]TestCategory{{ID: 1, ParentID: 5}}), ErrInvalidParent, 1},
+		{"Self parent", load([]TestCategory{{ID: 4, ParentID: 4}}), ErrSelfParent, 4},
+		{"Cycle", load([]TestCategory{{ID: 1, ParentID: 2}, {ID: 2, ParentID: 1}}), ErrCircularReference, 0},
+		{"Map key mismatch", New[TestCategory]().LoadMap(map[int]TestCategory{1: {ID: 2}}, opts...), ErrInvalidID, 1},
+		{"Nested empty", New[TestCategory]().LoadFromNested(nil), ErrEmptyData, 0},
+		{"AddNode duplicate", tree.AddNode(TestCategory{ID: 5, ParentID: 1}), ErrDuplicateID, 5},
+		{"AddNode missing parent", tree.AddNode(TestCategory{ID: 30, ParentID: 99}), ErrInvalidParent, 30},
+		{"Move missing node", tree.MoveBefore(99, 4), ErrNodeNotFound, 99},
+		{"Move missing target", tree.MoveAfter(4, 99), ErrNodeNotFound, 99},
+		{"Move under descendant", tree.CanMove(2, 5), ErrCircularReference, 2},
+		{"Remove missing node", tree.RemoveNode(99, RemoveCascade), ErrNodeNotFound, 99},
+		{"Update missing node", tree.UpdateNodeData(99, TestCategory{ID: 99}), ErrNodeNotFound, 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.want) {
+				t.Fatalf("error = %v, want it to wrap %q", tt.err, tt.want)
+			}
+			var nodeErr *NodeError
+			if !errors.As(tt.err, &nodeErr) {
+				if tt.wantID != 0 {
+					t.Errorf("error = %v, want a *NodeError for node %d", tt.err, tt.wantID)
+				}
+				return
+			}
+			// Cycles are reported at whichever node the check reaches first
+			if tt.want != ErrCircularReference && nodeErr.ID != tt.wantID {
+				t.Errorf("NodeError.ID = %d, want %d", nodeErr.ID, tt.wantID)
+			}
+		})
+	}
+
+	if got := (&NodeError{ID: 7, Err: ErrDuplicateID}).Error(); got != "node 7: duplicate node ID" {
+		t.Errorf("NodeError.Error() default = %q", got)
+	}
+}
+
+func TestDefaultSortWithoutIDField(t *testing.T) {
+	type item struct {
+		Key    string // Not an int ID field
+		Parent string
+	}
+	ids := map[string]int{"root": 1, "b": 3, "a": 2, "c": 10}
+
+	tr := New[item]()
+	err := tr.Load([]item{{"c", "root"}, {"root", ""}, {"b", "root"}, {"a", "root"}},
+		WithIDFunc(func(i item) int { return ids[i.Key] }),
+		WithParentIDFunc(func(i item) int { return ids[i.Parent] }),
+	)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := tr.GetChildrenIDs(1), []int{2, 3, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(1) = %v, want %v", got, want)
+	}
+
+	// Non-struct data
+	mt := New[map[string]any]()
+	err = mt.Load([]map[string]any{{"id": 1, "parent": 0}, {"id": 3, "parent": 1}, {"id": 2, "parent": 1}},
+		WithIDFunc(func(m map[string]any) int { return m["id"].(int) }),
+		WithParentIDFunc(func(m map[string]any) int { return m["parent"].(int) }),
+		WithLazySort[map[string]any](),
+	)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := mt.GetChildrenIDs(1), []int{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChildrenIDs(1) = %v, want %v", got, want)
+	}
+}
+
+type displayStatus int
+
+func (s displayStatus) String() string {
+	if s == 1 {
+		return "active"
+	}
+	return "inactive"
+}
+
+func TestFormatTreeDisplayFieldKinds(t *testing.T) {
+	type profile struct {
+		DisplayName string
+	}
+	type item struct {
+		ID       int
+		ParentID int
+		Code     int
+		Status   displayStatus
+		Profile  profile
+		Owner    *profile
+	}
+
+	tree := New[item]()
+	err := tree.Load([]item{
+		{ID: 1, Code: 100, Status: 1, Profile: profile{"Root"}, Owner: &profile{"alice"}},
+		{ID: 2, ParentID: 1, Code: 200, Status: 0, Profile: profile{"Child"}},
+	},
+		WithIDFunc(func(i item) int { return i.ID }),
+		WithParentIDFunc(func(i item) int { return i.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"Code", []string{"100", " └ 200"}},
+		{"Status", []string{"active", " └ inactive"}},
+		{"Profile.DisplayName", []string{"Root", " └ Child"}},
+		{"Owner.DisplayName", []string{"alice", " └ "}}, // Nil pointer on the path
+		{"Profile.Missing", []string{" └ "}},
+		{"Code.Value", []string{" └ "}}, // Path into a non-struct
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			opt := DefaultFormatOption()
+			opt.DisplayField = tt.field
+			var got []string
+			for _, node := range tree.FormatTreeDisplay(1, opt) {
+				got = append(got, node.DisplayName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FormatTreeDisplay() with field %q = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTreeDisplayFunc(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Missing"
+	opt.DisplayFields = []string{"Missing"}
+	formatted := tree.FormatTreeDisplayFunc(3, func(c TestCategory) string {
+		return fmt.Sprintf("%s (#%d)", c.Title, c.ID)
+	}, opt)
+	var got []string
+	for _, node := range formatted {
+		got = append(got, node.DisplayName)
+	}
+	if want := []string{"Child 2 (#3)", " └ Child 2.1 (#6)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FormatTreeDisplayFunc() = %q, want %q", got, want)
+	}
+	if len(tree.display) != 0 {
+		t.Errorf("FormatTreeDisplayFunc() cached %d results, want none", len(tree.display))
+	}
+	if got := tree.FormatTreeDisplayFunc(99, func(c TestCategory) string { return c.Title }, opt); got == nil || len(got) != 0 {
+		t.Errorf("FormatTreeDisplayFunc() on missing root = %v, want empty slice", got)
+	}
+
+	// Non-struct data works without reflection
+	names := New[string]()
+	ids := map[string]int{"root": 1, "leaf": 2}
+	err = names.Load([]string{"root", "leaf"},
+		WithIDFunc(func(s string) int { return ids[s] }),
+		WithParentIDFunc(func(s string) int {
+			if s == "leaf" {
+				return 1
+			}
+			return 0
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	got = got[:0]
+	for _, node := range names.FormatTreeDisplayFunc(1, strings.ToUpper, DefaultFormatOption()) {
+		got = append(got, node.DisplayName)
+	}
+	if want := []string{"ROOT", " └ LEAF"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FormatTreeDisplayFunc() on strings = %q, want %q", got, want)
+	}
+}
+
+func TestFormatTreeDisplayStyle(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opt  FormatOption
+		want []string
+	}{
+		{
+			name: "unicode",
+			opt:  FormatOption{DisplayField: "Title", Style: StyleUnicode},
+			want: []string{"Child 1.2", " ├ Child 1.2.1", " └ Child 1.2.2", "  ├ Child 1.2.2.1", "  └ Child 1.2.2.2"},
+		},
+		{
+			name: "ascii",
+			opt:  FormatOption{DisplayField: "Title", Style: StyleASCII},
+			want: []string{"Child 1.2", " +- Child 1.2.1", " `- Child 1.2.2", "  +- Child 1.2.2.1", "  `- Child 1.2.2.2"},
+		},
+		{
+			name: "rounded overrides icons",
+			opt:  FormatOption{DisplayField: "Title", Style: StyleRounded, Icons: []string{"|", "+ ", "\\ "}},
+			want: []string{"Child 1.2", " ├─ Child 1.2.1", " ╰─ Child 1.2.2", "  ├─ Child 1.2.2.1", "  ╰─ Child 1.2.2.2"},
+		},
+		{
+			name: "explicit indent is kept",
+			opt:  FormatOption{DisplayField: "Title", Style: StyleASCII, Indent: "--"},
+			want: []string{"Child 1.2", "--+- Child 1.2.1", "--`- Child 1.2.2", "----+- Child 1.2.2.1", "----`- Child 1.2.2.2"},
+		},
+		{
+			name: "unknown style falls back to icons",
+			opt:  FormatOption{DisplayField: "Title", Style: "bogus", Icons: []string{"|", "+ ", "\\ "}},
+			want: []string{"Child 1.2", " + Child 1.2.1", " \\ Child 1.2.2", "  + Child 1.2.2.1", "  \\ Child 1.2.2.2"},
+		},
+		{
+			name: "wrong icon count falls back to default",
+			opt:  FormatOption{DisplayField: "Title", Icons: []string{"|", "+ "}},
+			want: []string{"Child 1.2", " ├ Child 1.2.1", " └ Child 1.2.2", "  ├ Child 1.2.2.1", "  └ Child 1.2.2.2"},
+		},
+	}
+
+	collapsed := map[int]bool{10: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, node := range tree.FormatTreeDisplayCollapsed(5, collapsed, tt.opt) {
+				got = append(got, node.DisplayName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FormatTreeDisplayCollapsed() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTreeDisplayPlain(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	opt := FormatOption{DisplayField: "Title", Indent: "  ", Plain: true, Style: StyleUnicode}
+	var got []string
+	for _, node := range tree.FormatTreeDisplayCollapsed(2, map[int]bool{10: true}, opt) {
+		got = append(got, node.DisplayName)
+	}
+	want := []string{
+		"Child 1",
+		"  Child 1.1",
+		"  Child 1.2",
+		"    Child 1.2.1",
+		"    Child 1.2.2",
+		"      Child 1.2.2.1",
+		"      Child 1.2.2.2",
+		"  Child 1.3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FormatTreeDisplayCollapsed() = %q, want %q", got, want)
+	}
+}
+
+func TestToMermaid(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	title := func(c TestCategory) string { return c.Title }
+
+	got, err := tree.ToMermaid(5, title)
+	if err != nil {
+		t.Fatalf("ToMermaid() error = %v", err)
+	}
+	want := `graph TD
+    n5["Child 1.2"]
+    n5 --> n7["Child 1.2.1"]
+    n5 --> n8["Child 1.2.2"]
+    n8 --> n9["Child 1.2.2.1"]
+    n8 --> n10["Child 1.2.2.2"]
+    n10 --> n11["Child 1.2.2.2.1"]
+    n10 --> n12["Child 1.2.2.2.2"]
+    n12 --> n13["Child 1.2.2.2.2.1"]
+    n12 --> n14["Child 1.2.2.2.2.2"]
+    n14 --> n15["Child 1.2.2.2.2.2.1"]
+    n14 --> n16["Child 1.2.2.2.2.2.2"]
+`
+	if got != want {
+		t.Errorf("ToMermaid(5) =\n%s\nwant\n%s", got, want)
+	}
+
+	// A leaf produces only its declaration, labels are escaped
+	got, err = tree.ToMermaid(7, func(c TestCategory) string { return `Say "hi" <b>#1</b>` + "\nnext" })
+	if err != nil {
+		t.Fatalf("ToMermaid() error = %v", err)
+	}
+	want = "graph TD\n    n7[\"Say #quot;hi#quot; #lt;b#gt;#35;1#lt;/b#gt; next\"]\n"
+	if got != want {
+		t.Errorf("ToMermaid(7) = %q, want %q", got, want)
+	}
+
+	if _, err := tree.ToMermaid(999, title); !errors.Is(err, ErrNodeNotFound) || err.Error() != "root node 999 not found" {
+		t.Errorf("ToMermaid(999) error = %v, want root node 999 not found", err)
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	title := func(c TestCategory) string { return c.Title }
+
+	got, err := tree.ToDOT(1, title)
+	if err != nil {
+		t.Fatalf("ToDOT(1) error = %v", err)
+	}
+	want := `digraph {
+    rankdir=TB;
+    1 [label="Root"];
+    2 [label="Child 1"];
+    1 -> 2;
+    4 [label="Child 1.1"];
+    2 -> 4;
+    5 [label="Child 1.2"];
+    2 -> 5;
+    7 [label="Child 1.2.1"];
+    5 -> 7;
+    8 [label="Child 1.2.2"];
+    5 -> 8;
+    9 [label="Child 1.2.2.1"];
+    8 -> 9;
+    10 [label="Child 1.2.2.2"];
+    8 -> 10;
+    11 [label="Child 1.2.2.2.1"];
+    10 -> 11;
+    12 [label="Child 1.2.2.2.2"];
+    10 -> 12;
+    13 [label="Child 1.2.2.2.2.1"];
+    12 -> 13;
+    14 [label="Child 1.2.2.2.2.2"];
+    12 -> 14;
+    15 [label="Child 1.2.2.2.2.2.1"];
+    14 -> 15;
+    16 [label="Child 1.2.2.2.2.2.2"];
+    14 -> 16;
+    17 [label="Child 1.3"];
+    2 -> 17;
+    3 [label="Child 2"];
+    1 -> 3;
+    6 [label="Child 2.1"];
+    3 -> 6;
+}
+`
+	if got != want {
+		t.Errorf("ToDOT(1) =\n%s\nwant\n%s", got, want)
+	}
+
+	// Left-to-right layout with IDs in labels, special characters escaped
+	got, err = tree.ToDOTWithOptions(3, func(c TestCategory) string {
+		return `"` + c.Title + `" \ end` + "\nline"
+	}, DOTOption{LeftToRight: true, ShowID: true})
+	if err != nil {
+		t.Fatalf("ToDOTWithOptions(3) error = %v", err)
+	}
+	want = `digraph {
+    rankdir=LR;
+    3 [label="3: \"Child 2\" \\ end\nline"];
+    6 [label="6: \"Child 2.1\" \\ end\nline"];
+    3 -> 6;
+}
+`
+	if got != want {
+		t.Errorf("ToDOTWithOptions(3) =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := tree.ToDOT(999, title); !errors.Is(err, ErrNodeNotFound) || err.Error() != "root node 999 not found" {
+		t.Errorf("ToDOT(999) error = %v, want root node 999 not found", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		WithSort(func(a, b TestCategory) bool { return a.Title > b.Title }),
+		WithLazySort[TestCategory](),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	tree.SetMeta(4, "expanded", true)
+
+	clone := tree.Clone()
+	wantDescendants := tree.GetDescendantsIDs(1, 0)
+	if got := clone.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, wantDescendants) {
+		t.Errorf("clone GetDescendantsIDs(1, 0) = %v, want %v", got, wantDescendants)
+	}
+
+	// Changes to the original don't reach the clone
+	tree.SetMeta(4, "expanded", false)
+	if err := tree.UpdateNodeData(6, TestCategory{ID: 6, ParentID: 3, Title: "Renamed"}); err != nil {
+		t.Fatalf("UpdateNodeData() error = %v", err)
+	}
+	if err := tree.RemoveNode(8, RemoveCascade); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	if got := clone.GetDescendantsIDs(1, 0); !reflect.DeepEqual(got, wantDescendants) {
+		t.Errorf("clone GetDescendantsIDs(1, 0) after changes = %v, want %v", got, wantDescendants)
+	}
+	if node, _ := clone.FindNode(6); node.Data.Title != "Child 2.1" {
+		t.Errorf("clone node 6 title = %q, want %q", node.Data.Title, "Child 2.1")
+	}
+	if v, _ := clone.GetMeta(4, "expanded"); v != true {
+		t.Errorf("clone GetMeta(4) = %v, want true", v)
+	}
+
+	// The clone keeps the load options and changes independently
+	if err := clone.AddNode(TestCategory{ID: 20, ParentID: 2, Title: "Child 1.0"}); err != nil {
+		t.Fatalf("clone AddNode() error = %v", err)
+	}
+	if got, want := clone.GetChildrenIDs(2), []int{17, 5, 4, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("clone GetChildrenIDs(2) = %v, want %v", got, want)
+	}
+	if _, exists := tree.FindNode(20); exists {
+		t.Error("node added to the clone appeared in the original")
+	}
+
+	// Cloning an empty tree gives an empty tree
+	if got := New[TestCategory]().Clone().GetDescendantsIDs(0, 0); len(got) != 0 {
+		t.Errorf("empty clone GetDescendantsIDs(0, 0) = %v, want empty", got)
+	}
+}
+
+func TestFormatTreeDisplayCache(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	opt := DefaultFormatOption()
+	opt.DisplayField = "Title"
+	names := func(rows []FormattedNode[TestCategory]) []string {
+		var got []string
+		for _, row := range rows {
+			got = append(got, row.DisplayName)
+		}
+		return got
+	}
+
+	first := tree.FormatTreeDisplay(3, opt)
+	if len(tree.display) != 1 {
+		t.Fatalf("expected 1 cached result, got %d", len(tree.display))
+	}
+	// Changing the returned rows doesn't change the cache
+	first[0].DisplayName = "changed"
+	if got, want := names(tree.FormatTreeDisplay(3, opt)), []string{"Child 2", " └ Child 2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached FormatTreeDisplay(3) = %q, want %q", got, want)
+	}
+	// Equal options with their defaults applied share an entry
+	tree.FormatTreeDisplay(3, FormatOption{DisplayField: "Title", Style: StyleUnicode})
+	if len(tree.display) != 1 {
+		t.Errorf("expected equivalent options to share the cached result, got %d entries", len(tree.display))
+	}
+
+	// Options that can't be keyed or opt out of caching don't fill the cache
+	tree.FormatTreeDisplayFunc(1, func(c TestCategory) string { return c.Title }, opt)
+	tree.FormatTreeDisplayNoCache(1, opt)
+	tree.FormatTreeDisplayCollapsed(1, map[int]bool{2: true}, opt)
+	if len(tree.display) != 1 {
+		t.Errorf("expected 1 cached result, got %d", len(tree.display))
+	}
+
+	mutations := []struct {
+		name   string
+		mutate func() error
+		want   []string
+	}{
+		{
+			name: "UpdateNodeData",
+			mutate: func() error {
+				return tree.UpdateNodeData(6, TestCategory{ID: 6, ParentID: 3, Title: "Renamed"})
+			},
+			want: []string{"Child 2", " └ Renamed"},
+		},
+		{
+			name:   "AddNode",
+			mutate: func() error { return tree.AddNode(TestCategory{ID: 20, ParentID: 3, Title: "Added"}) },
+			want:   []string{"Child 2", " ├ Renamed", " └ Added"},
+		},
+		{
+			name:   "MoveBefore",
+			mutate: func() error { return tree.MoveBefore(20, 6) },
+			want:   []string{"Child 2", " ├ Added", " └ Renamed"},
+		},
+		{
+			name:   "RemoveNode",
+			mutate: func() error { return tree.RemoveNode(6, RemoveCascade) },
+			want:   []string{"Child 2", " └ Added"},
+		},
+		{
+			name:   "RemoveChildren",
+			mutate: func() error { tree.RemoveChildren(3); return nil },
+			want:   []string{"Child 2"},
+		},
+		{
+			name: "Load",
+			mutate: func() error {
+				return tree.Load(getTestData(),
+					WithIDFunc(func(c TestCategory) int { return c.ID }),
+					WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+				)
+			},
+			want: []string{"Child 2", " └ Child 2.1"},
+		},
+		{
+			name:   "Clear",
+			mutate: func() error { tree.Clear(); return nil },
+			want:   nil,
+		},
+	}
+	for _, m := range mutations {
+		t.Run(m.name, func(t *testing.T) {
+			tree.FormatTreeDisplay(3, opt)
+			if err := m.mutate(); err != nil {
+				t.Fatalf("%s() error = %v", m.name, err)
+			}
+			if got := names(tree.FormatTreeDisplay(3, opt)); !reflect.DeepEqual(got, m.want) {
+				t.Errorf("FormatTreeDisplay(3) after %s = %q, want %q", m.name, got, m.want)
+			}
+		})
+	}
+
+	// Concurrent renders and updates, run with -race to check the cache
+	err = tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if rows := tree.FormatTreeDisplay(1, opt); len(rows) != 17 {
+				t.Errorf("concurrent FormatTreeDisplay(1) returned %d rows, want 17", len(rows))
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			_ = tree.UpdateNodeData(6, TestCategory{ID: 6, ParentID: 3, Title: fmt.Sprint("Child 2.1 #", i)})
+		}(i)
+	}
+	wg.Wait()
+	if got, want := tree.FormatTreeDisplay(6, opt)[0].DisplayName, tree.FormatTreeDisplayNoCache(6, opt)[0].DisplayName; got != want {
+		t.Errorf("cached FormatTreeDisplay(6) = %q, want %q", got, want)
+	}
+
+	// Only the most recent results are kept
+	for id := 1; id <= 17; id++ {
+		tree.FormatTreeDisplay(id, opt)
+	}
+	if len(tree.display) != maxDisplayCache || len(tree.displayOrder) != maxDisplayCache {
+		t.Fatalf("cache holds %d results in %d keys, want %d", len(tree.display), len(tree.displayOrder), maxDisplayCache)
+	}
+	if _, cached := tree.display[newDisplayKey(1, formatDefaults(opt))]; cached {
+		t.Error("oldest result for root 1 should have been evicted")
+	}
+	if _, cached := tree.display[newDisplayKey(17, formatDefaults(opt))]; !cached {
+		t.Error("newest result for root 17 should be cached")
+	}
+}
+
+func TestGetDescendantsFiltered(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	// Leaves only, so matches sit below non-matching nodes
+	isLeaf := func(c TestCategory) bool { return len(tree.children[c.ID]) == 0 }
+	evenID := func(c TestCategory) bool { return c.ID%2 == 0 }
+
+	tests := []struct {
+		name     string
+		id       int
+		maxDepth int
+		keep     func(TestCategory) bool
+	}{
+		{"Leaves unlimited", 1, DepthUnlimited, isLeaf},
+		{"Leaves depth 3", 1, 3, isLeaf},
+		{"Even IDs in subtree", 5, DepthUnlimited, evenID},
+		{"Even IDs depth 1", 8, 1, evenID},
+		{"No matches", 1, DepthUnlimited, func(TestCategory) bool { return false }},
+		{"Depth none", 1, DepthNone, evenID},
+		{"Missing node", 999, DepthUnlimited, evenID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make([]int, 0)
+			for _, node := range tree.GetDescendants(tt.id, tt.maxDepth) {
+				if tt.keep(node.Data) {
+					want = append(want, node.ID)
+				}
+			}
+			got := make([]int, 0)
+			for _, node := range tree.GetDescendantsFiltered(tt.id, tt.maxDepth, tt.keep) {
+				got = append(got, node.ID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetDescendantsFiltered(%d, %d) = %v, want %v", tt.id, tt.maxDepth, got, want)
+			}
+		})
+	}
+
+	var leaves []int
+	for _, node := range tree.GetDescendantsFiltered(1, 3, isLeaf) {
+		leaves = append(leaves, node.ID)
+	}
+	if want := []int{4, 17, 7, 6}; !reflect.DeepEqual(leaves, want) {
+		t.Errorf("GetDescendantsFiltered(1, 3, isLeaf) = %v, want %v", leaves, want)
+	}
+	if got := tree.GetDescendantsFiltered(999, DepthUnlimited, evenID); got == nil {
+		t.Error("GetDescendantsFiltered(999) = nil, want empty slice")
+	}
+}
+
+func TestGetOneNodeAndGetAllNodes(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+
+	leafOf := func(parentID int) func(*Node[TestCategory]) bool {
+		return func(n *Node[TestCategory]) bool {
+			return n.ParentID == parentID && len(n.Children) == 0
+		}
+	}
+
+	tests := []struct {
+		name    string
+		matcher func(*Node[TestCategory]) bool
+		want    []int
+	}{
+		{"Leaves of 2", leafOf(2), []int{4, 17}},
+		{"Leaves of 8", leafOf(8), []int{9}},
+		{"Children sorted", func(n *Node[TestCategory]) bool {
+			return len(n.Children) == 2 && n.Children[0].ID < n.Children[1].ID && n.ParentID != 0
+		}, []int{5, 8, 10, 12, 14}},
+		{"No matches", leafOf(999), []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]int, 0)
+			for _, node := range tree.GetAllNodes(tt.matcher) {
+				if node.Children != nil {
+					t.Errorf("GetAllNodes() returned node %d with Children set", node.ID)
+				}
+				got = append(got, node.ID)
+			}
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAllNodes() = %v, want %v", got, tt.want)
+			}
+
+			node := tree.GetOneNode(tt.matcher)
+			if len(tt.want) == 0 {
+				if node != nil {
+					t.Errorf("GetOneNode() = %d, want nil", node.ID)
+				}
+			} else if node == nil || !slices.Contains(tt.want, node.ID) {
+				t.Errorf("GetOneNode() = %v, want one of %v", node, tt.want)
+			}
+		})
+	}
+
+	// The returned node is the stored node
+	node := tree.GetOneNode(func(n *Node[TestCategory]) bool { return n.ID == 6 })
+	if stored, _ := tree.FindNode(6); node != stored {
+		t.Errorf("GetOneNode() = %p, want the stored node %p", node, stored)
+	}
+}
+
+func TestGetAllOrder(t *testing.T) {
+	load := func(t *testing.T, opts ...LoadOption[TestCategory]) *Tree[TestCategory] {
+		tree := New[TestCategory]()
+		err := tree.Load(getTestData(), append([]LoadOption[TestCategory]{
+			WithIDFunc(func(c TestCategory) int { return c.ID }),
+			WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("Failed to load test data: %v", err)
+		}
+		return tree
+	}
+	ids := func(nodes []*Node[TestCategory]) []int {
+		got := make([]int, 0, len(nodes))
+		for _, node := range nodes {
+			got = append(got, node.ID)
+		}
+		return got
+	}
+	inChild1 := func(c TestCategory) bool { return strings.HasPrefix(c.Title, "Child 1.2") }
+
+	tests := []struct {
+		name    string
+		opts    []LoadOption[TestCategory]
+		wantAll []int
+		wantOne int
+	}{
+		{
+			name:    "By ID",
+			wantAll: []int{5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			wantOne: 5,
+		},
+		{
+			name:    "By title descending",
+			opts:    []LoadOption[TestCategory]{WithSort(func(a, b TestCategory) bool { return a.Title > b.Title })},
+			wantAll: []int{5, 8, 10, 12, 14, 16, 15, 13, 11, 9, 7},
+			wantOne: 5,
+		},
+		{
+			name:    "Lazy sort",
+			opts:    []LoadOption[TestCategory]{WithLazySort[TestCategory]()},
+			wantAll: []int{5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			wantOne: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := load(t, tt.opts...)
+			// Repeated calls give the same pre-order result
+			for i := 0; i < 5; i++ {
+				if got := ids(tree.GetAll(inChild1)); !reflect.DeepEqual(got, tt.wantAll) {
+					t.Fatalf("GetAll() = %v, want %v", got, tt.wantAll)
+				}
+			}
+			if got := ids(tree.GetAllNodes(func(n *Node[TestCategory]) bool { return inChild1(n.Data) })); !reflect.DeepEqual(got, tt.wantAll) {
+				t.Errorf("GetAllNodes() = %v, want %v", got, tt.wantAll)
+			}
+			if node := tree.GetOne(inChild1); node == nil || node.ID != tt.wantOne {
+				t.Errorf("GetOne() = %v, want node %d", node, tt.wantOne)
+			}
+		})
+	}
+
+	// The first leaf in pre-order, with its depth
+	tree := load(t)
+	isLeaf := func(c TestCategory) bool { return len(tree.children[c.ID]) == 0 }
+	if node, depth, ok := tree.GetOneWithDepth(isLeaf); !ok || node.ID != 4 || depth != 2 {
+		t.Errorf("GetOneWithDepth() = %v, %d, %v, want node 4 at depth 2", node, depth, ok)
+	}
+	if node := tree.GetOneNode(func(n *Node[TestCategory]) bool { return len(n.Children) == 0 }); node == nil || node.ID != 4 {
+		t.Errorf("GetOneNode() = %v, want node 4", node)
+	}
+	want := []int{1, 2, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 3, 6}
+	if got := ids(tree.GetAll(func(TestCategory) bool { return true })); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll(all) = %v, want %v", got, want)
+	}
+}
+
+func TestTraversalsWithContext(t *testing.T) {
+	tree := New[TestCategory]()
+	err := tree.Load(getTestData(),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	inChild1 := func(c TestCategory) bool { return strings.HasPrefix(c.Title, "Child 1") }
+
+	// Without cancellation the results match the plain methods
+	for _, tc := range []struct{ id, maxDepth int }{{1, DepthUnlimited}, {2, 2}, {5, DepthNone}, {999, DepthUnlimited}} {
+		got, err := tree.GetDescendantsCtx(context.Background(), tc.id, tc.maxDepth)
+		if want := tree.GetDescendants(tc.id, tc.maxDepth); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("GetDescendantsCtx(%d, %d) = %v, %v, want %v", tc.id, tc.maxDepth, got, err, want)
+		}
+	}
+	got, err := tree.GetAllCtx(context.Background(), inChild1)
+	if want := tree.GetAll(inChild1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllCtx() = %v, %v, want %v", got, err, want)
+	}
+
+	// A context that is already done stops before the traversal
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := tree.GetDescendantsCtx(cancelled, 1, DepthUnlimited); got != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("GetDescendantsCtx(cancelled) = %v, %v, want nil, context.Canceled", got, err)
+	}
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if got, err := tree.GetAllCtx(expired, inChild1); got != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetAllCtx(expired) = %v, %v, want nil, context.DeadlineExceeded", got, err)
+	}
+
+	// Cancelling during a long scan stops it within the check interval
+	large := New[TestCategory]()
+	err = large.Load(buildWideTree(10000, 4),
+		WithIDFunc(func(c TestCategory) int { return c.ID }),
+		WithParentIDFunc(func(c TestCategory) int { return c.ParentID }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load test data: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	got, err = large.GetAllCtx(ctx, func(TestCategory) bool {
+		calls++
+		if calls == 100 {
+			cancel()
+		}
+		return true
+	})
+	if got != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAllCtx(cancelled during scan) = %d nodes, %v, want nil, context.Canceled", len(got), err)
+	}
+	if calls > ctxCheckInterval {
+		t.Errorf("GetAllCtx() visited %d nodes after cancellation, want at most %d", calls, ctxCheckInterval)
+	}
+}